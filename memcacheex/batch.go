@@ -0,0 +1,95 @@
+package memcacheex
+
+import (
+	"sync"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+type BatchClient interface {
+	Client
+	SetMulti(items []*memcache.Item) map[string]error
+	DeleteMulti(keys []string) map[string]error
+	TouchMulti(keys []string, seconds int32) map[string]error
+}
+
+// batchParallelism is the maximum number of concurrent requests of a batch.
+const batchParallelism = 16
+
+// runBatch calls fn for 0 to n-1 in parallel and collects the errors by
+// the returned keys. It returns nil if there are no errors.
+func runBatch(n int, fn func(i int) (string, error)) map[string]error {
+	var mu sync.Mutex
+	var errs map[string]error
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, batchParallelism)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			key, err := fn(i)
+			if err == nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if errs == nil {
+				errs = make(map[string]error)
+			}
+			errs[key] = err
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+// batch calls fn for every key. With a ServerSelector, the keys are grouped
+// by server, and each server gets its keys one after another while servers
+// are written concurrently, so that a batch does not open a connection per
+// key. Without one, the keys are written by runBatch. The errors are
+// collected by key, and PickServer errors are reported for their keys.
+func (cw *ClientWrapper) batch(keys []string, fn func(i int) error) map[string]error {
+	if cw.selector == nil {
+		return runBatch(len(keys), func(i int) (string, error) {
+			return keys[i], fn(i)
+		})
+	}
+
+	var mu sync.Mutex
+	var errs map[string]error
+	fail := func(key string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if errs == nil {
+			errs = make(map[string]error)
+		}
+		errs[key] = err
+	}
+
+	groups := make(map[string][]int)
+	for i, key := range keys {
+		addr, err := cw.selector.PickServer(key)
+		if err != nil {
+			fail(key, err)
+			continue
+		}
+		groups[addr.String()] = append(groups[addr.String()], i)
+	}
+
+	var wg sync.WaitGroup
+	for _, group := range groups {
+		wg.Add(1)
+		go func(group []int) {
+			defer wg.Done()
+			for _, i := range group {
+				if err := fn(i); err != nil {
+					fail(keys[i], err)
+				}
+			}
+		}(group)
+	}
+	wg.Wait()
+	return errs
+}
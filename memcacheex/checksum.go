@@ -0,0 +1,161 @@
+package memcacheex
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"sync/atomic"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+var _ Client = (*ChecksumClient)(nil)
+
+// checksumFlag marks items with a checksum in Item.Flags.
+const checksumFlag = 0x800
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// CorruptionError is returned by ChecksumClient for corrupted values when
+// the ReturnError policy is used.
+type CorruptionError struct {
+	Key string
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("memcacheex: value of %q is corrupted", e.Key)
+}
+
+// CorruptionPolicy decides what ChecksumClient returns for corrupted values.
+type CorruptionPolicy int
+
+const (
+	// ReturnMiss treats corrupted values as cache misses.
+	ReturnMiss CorruptionPolicy = iota
+	// ReturnError returns a *CorruptionError.
+	ReturnError
+)
+
+type ChecksumOptions struct {
+	Policy CorruptionPolicy
+	// AutoDelete deletes corrupted values.
+	AutoDelete bool
+	// OnCorruption, if set, is called with the key of every corrupted value.
+	OnCorruption func(key string)
+}
+
+// ChecksumClient appends a CRC32C of the value on writes and verifies it on
+// Get and GetMulti. Items with a checksum are marked by bit 11 of
+// Item.Flags, items without one are returned as is. Increment and Decrement
+// are passed through, so counters keep working.
+type ChecksumClient struct {
+	Client
+	opts      ChecksumOptions
+	corrupted uint64
+}
+
+func NewChecksumClient(client Client, opts ChecksumOptions) *ChecksumClient {
+	return &ChecksumClient{Client: client, opts: opts}
+}
+
+// Corrupted returns the number of corrupted values detected.
+func (cc *ChecksumClient) Corrupted() uint64 {
+	return atomic.LoadUint64(&cc.corrupted)
+}
+
+func (cc *ChecksumClient) Get(key string) (*memcache.Item, error) {
+	item, err := cc.Client.Get(key)
+	if err != nil {
+		return item, err
+	}
+	if !verifyItem(item) {
+		return nil, cc.corruption(key)
+	}
+	return item, nil
+}
+
+// GetMulti is a batch version of Get. Corrupted values are left out of the
+// result. With the ReturnError policy the *CorruptionError of every one of
+// them, in the order of keys, is returned as a MultiError along with the
+// other items and an error of the underlying GetMulti, if any.
+func (cc *ChecksumClient) GetMulti(keys []string) (map[string]*memcache.Item, error) {
+	items, err := cc.Client.GetMulti(keys)
+	var errs MultiError
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, key := range keys {
+		item, ok := items[key]
+		if !ok || verifyItem(item) {
+			continue
+		}
+		delete(items, key)
+		if cerr := cc.corruption(key); cerr != memcache.ErrCacheMiss {
+			errs = append(errs, cerr)
+		}
+	}
+	switch len(errs) {
+	case 0:
+		return items, nil
+	case 1:
+		return items, errs[0]
+	}
+	return items, errs
+}
+
+func (cc *ChecksumClient) Set(item *memcache.Item) error {
+	return cc.Client.Set(checksumItem(item))
+}
+
+func (cc *ChecksumClient) Add(item *memcache.Item) error {
+	return cc.Client.Add(checksumItem(item))
+}
+
+func (cc *ChecksumClient) Replace(item *memcache.Item) error {
+	return cc.Client.Replace(checksumItem(item))
+}
+
+func (cc *ChecksumClient) CompareAndSwap(item *memcache.Item) error {
+	return cc.Client.CompareAndSwap(checksumItem(item))
+}
+
+func (cc *ChecksumClient) corruption(key string) error {
+	atomic.AddUint64(&cc.corrupted, 1)
+	if cc.opts.OnCorruption != nil {
+		cc.opts.OnCorruption(key)
+	}
+	if cc.opts.AutoDelete {
+		cc.Client.Delete(key)
+	}
+	if cc.opts.Policy == ReturnError {
+		return &CorruptionError{Key: key}
+	}
+	return memcache.ErrCacheMiss
+}
+
+// checksumItem returns a copy of item with the checksum appended to the value.
+func checksumItem(item *memcache.Item) *memcache.Item {
+	it := *item
+	it.Value = make([]byte, len(item.Value)+4)
+	n := copy(it.Value, item.Value)
+	binary.BigEndian.PutUint32(it.Value[n:], crc32.Checksum(item.Value, castagnoli))
+	it.Flags |= checksumFlag
+	return &it
+}
+
+// verifyItem strips and verifies the checksum of item, if it has one.
+func verifyItem(item *memcache.Item) bool {
+	if item.Flags&checksumFlag == 0 {
+		return true
+	}
+	n := len(item.Value) - 4
+	if n < 0 {
+		return false
+	}
+	if binary.BigEndian.Uint32(item.Value[n:]) != crc32.Checksum(item.Value[:n], castagnoli) {
+		return false
+	}
+	item.Value = item.Value[:n]
+	item.Flags &^= checksumFlag
+	return true
+}
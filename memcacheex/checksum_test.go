@@ -0,0 +1,93 @@
+package memcacheex
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+func TestChecksumClient(t *testing.T) {
+	corrupt := func(fc *fakeClient, key string) {
+		stored, _ := fc.Get(key)
+		stored.Value = stored.Value[1:]
+		fc.Set(stored)
+	}
+
+	t.Run("Verified", func(t *testing.T) {
+		fc := newFakeClient()
+		cc := NewChecksumClient(fc, ChecksumOptions{})
+		item := &memcache.Item{Key: testKey, Value: []byte("value"), Flags: 1}
+		cc.Set(item)
+		if string(item.Value) != "value" || item.Flags != 1 {
+			t.Error("caller's item was modified")
+		}
+		if got, err := cc.Get(testKey); err != nil || string(got.Value) != "value" || got.Flags != 1 {
+			t.Errorf("unexpected result: %v, %v", got, err)
+		}
+		fc.Set(&memcache.Item{Key: "plain", Value: []byte("p")})
+		if got, err := cc.Get("plain"); err != nil || string(got.Value) != "p" {
+			t.Errorf("unexpected result: %v, %v", got, err)
+		}
+	})
+
+	t.Run("ReturnMiss", func(t *testing.T) {
+		fc := newFakeClient()
+		var reported []string
+		cc := NewChecksumClient(fc, ChecksumOptions{OnCorruption: func(key string) { reported = append(reported, key) }})
+		cc.Set(&memcache.Item{Key: testKey, Value: []byte("value")})
+		corrupt(fc, testKey)
+
+		if _, err := cc.Get(testKey); err != memcache.ErrCacheMiss {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if len(reported) != 1 || cc.Corrupted() != 1 {
+			t.Errorf("corruption was not reported: %v, %d", reported, cc.Corrupted())
+		}
+		if _, err := fc.Get(testKey); err != nil {
+			t.Error("corrupted value was deleted")
+		}
+	})
+
+	t.Run("ReturnErrorAndAutoDelete", func(t *testing.T) {
+		fc := newFakeClient()
+		cc := NewChecksumClient(fc, ChecksumOptions{Policy: ReturnError, AutoDelete: true})
+		cc.Set(&memcache.Item{Key: testKey, Value: []byte("value")})
+		cc.Set(&memcache.Item{Key: "ok", Value: []byte("ok")})
+		corrupt(fc, testKey)
+
+		items, err := cc.GetMulti([]string{testKey, "ok"})
+		var ce *CorruptionError
+		if !errors.As(err, &ce) || ce.Key != testKey {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if len(items) != 1 || string(items["ok"].Value) != "ok" {
+			t.Errorf("unexpected items: %v", items)
+		}
+		if _, err := fc.Get(testKey); err != memcache.ErrCacheMiss {
+			t.Errorf("corrupted value was not deleted: %v", err)
+		}
+	})
+
+	t.Run("ReturnErrorForEveryKey", func(t *testing.T) {
+		fc := newFakeClient()
+		cc := NewChecksumClient(fc, ChecksumOptions{Policy: ReturnError})
+		keys := []string{"c", "a", "b"}
+		for _, key := range keys {
+			cc.Set(&memcache.Item{Key: key, Value: []byte("value")})
+			corrupt(fc, key)
+		}
+
+		_, err := cc.GetMulti(keys)
+		var me MultiError
+		if !errors.As(err, &me) || len(me) != len(keys) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for i, err := range me {
+			var ce *CorruptionError
+			if !errors.As(err, &ce) || ce.Key != keys[i] {
+				t.Errorf("unexpected error %d: %v", i, err)
+			}
+		}
+	})
+}
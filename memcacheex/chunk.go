@@ -0,0 +1,284 @@
+package memcacheex
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strconv"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+var _ Client = (*ChunkingClient)(nil)
+
+// chunkFlag marks chunk manifests in Item.Flags.
+const chunkFlag = 0x1000
+
+// manifestSize is the size of a chunk manifest: the version nonce (8 bytes),
+// the number of chunks (4 bytes) and the total length (8 bytes).
+const manifestSize = 8 + 4 + 8
+
+type ChunkingOptions struct {
+	// ChunkSize is the maximum size of a value stored in one item.
+	// Defaults to 1MB minus 1KB for the key and the item overhead.
+	ChunkSize int
+}
+
+// ChunkingClient stores values larger than the chunk size as chunks under
+// separate keys, and a manifest under the original key. The chunk keys hold
+// a nonce recorded in the manifest, so that chunks of an older value are
+// never mixed with a newer one. Manifests are marked by bit 12 of Item.Flags.
+type ChunkingClient struct {
+	Client
+	opts ChunkingOptions
+}
+
+type chunkManifest struct {
+	nonce  [8]byte
+	count  uint32
+	length uint64
+}
+
+func (m *chunkManifest) marshal() []byte {
+	b := make([]byte, manifestSize)
+	copy(b, m.nonce[:])
+	binary.BigEndian.PutUint32(b[8:], m.count)
+	binary.BigEndian.PutUint64(b[12:], m.length)
+	return b
+}
+
+func (m *chunkManifest) unmarshal(b []byte) bool {
+	if len(b) != manifestSize {
+		return false
+	}
+	copy(m.nonce[:], b)
+	m.count = binary.BigEndian.Uint32(b[8:])
+	m.length = binary.BigEndian.Uint64(b[12:])
+	return true
+}
+
+// chunkKeyOverhead is the length that chunk keys add to the key: ":chunk:",
+// the hex nonce, ":" and the chunk index of up to 10 digits.
+const chunkKeyOverhead = 7 + 16 + 1 + 10
+
+// chunkKeyPolicy shortens keys too long to hold chunk keys by hashing them.
+var chunkKeyPolicy = KeyPolicy{MaxLength: maxKeyLength - chunkKeyOverhead}
+
+func (m *chunkManifest) chunkKeys(key string) []string {
+	prefix := chunkKeyPolicy.Key(key) + ":chunk:" + hex.EncodeToString(m.nonce[:]) + ":"
+	keys := make([]string, m.count)
+	for i := range keys {
+		keys[i] = prefix + strconv.Itoa(i)
+	}
+	return keys
+}
+
+func NewChunkingClient(client Client, opts ChunkingOptions) *ChunkingClient {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = 1024*1024 - 1024
+	}
+	return &ChunkingClient{Client: client, opts: opts}
+}
+
+// Get gets the item for the given key, reassembling chunked values with a
+// single GetMulti. Missing or mismatched chunks are a cache miss.
+func (cc *ChunkingClient) Get(key string) (*memcache.Item, error) {
+	item, err := cc.Client.Get(key)
+	if err != nil || item.Flags&chunkFlag == 0 {
+		return item, err
+	}
+	if err := cc.assemble([]*memcache.Item{item}); err != nil {
+		return nil, err
+	}
+	if item.Flags&chunkFlag != 0 {
+		return nil, memcache.ErrCacheMiss
+	}
+	return item, nil
+}
+
+// GetMulti is a batch version of Get. Chunks of all chunked values are
+// fetched with one more GetMulti. If the underlying GetMulti returns partial
+// results with an error, they are reassembled as well, and values that
+// cannot be reassembled are dropped.
+func (cc *ChunkingClient) GetMulti(keys []string) (map[string]*memcache.Item, error) {
+	items, err := cc.Client.GetMulti(keys)
+	if items == nil {
+		return items, err
+	}
+	var manifests []*memcache.Item
+	for _, item := range items {
+		if item.Flags&chunkFlag != 0 {
+			manifests = append(manifests, item)
+		}
+	}
+	if len(manifests) == 0 {
+		return items, err
+	}
+	if aerr := cc.assemble(manifests); aerr != nil && err == nil {
+		return nil, aerr
+	}
+	for key, item := range items {
+		if item.Flags&chunkFlag != 0 {
+			delete(items, key)
+		}
+	}
+	return items, err
+}
+
+// assemble replaces the values of the manifests with their reassembled
+// values. Manifests that cannot be reassembled keep the chunk flag.
+func (cc *ChunkingClient) assemble(manifests []*memcache.Item) error {
+	var keys []string
+	parsed := make([]chunkManifest, len(manifests))
+	for i, item := range manifests {
+		if parsed[i].unmarshal(item.Value) {
+			keys = append(keys, parsed[i].chunkKeys(item.Key)...)
+		}
+	}
+	chunks, err := cc.Client.GetMulti(keys)
+	if err != nil {
+		return err
+	}
+	for i, item := range manifests {
+		m := &parsed[i]
+		if m.count == 0 {
+			continue
+		}
+		value := make([]byte, 0, m.length)
+		for _, key := range m.chunkKeys(item.Key) {
+			chunk, ok := chunks[key]
+			if !ok {
+				value = nil
+				break
+			}
+			value = append(value, chunk.Value...)
+		}
+		if value == nil || uint64(len(value)) != m.length {
+			continue
+		}
+		item.Value = value
+		item.Flags &^= chunkFlag
+	}
+	return nil
+}
+
+func (cc *ChunkingClient) Set(item *memcache.Item) error {
+	return cc.write(item, cc.Client.Set, true)
+}
+
+func (cc *ChunkingClient) Add(item *memcache.Item) error {
+	return cc.write(item, cc.Client.Add, false)
+}
+
+func (cc *ChunkingClient) Replace(item *memcache.Item) error {
+	return cc.write(item, cc.Client.Replace, true)
+}
+
+func (cc *ChunkingClient) CompareAndSwap(item *memcache.Item) error {
+	return cc.write(item, cc.Client.CompareAndSwap, true)
+}
+
+// write splits item and stores the result with store. If store fails, the
+// new chunks are deleted. If it overwrites a chunked value, the chunks of
+// that value are deleted, which costs an extra Get for every overwrite.
+// Both deletes are best effort, chunks that are left expire with their
+// manifest or are evicted.
+func (cc *ChunkingClient) write(item *memcache.Item, store func(*memcache.Item) error, overwrite bool) error {
+	var old *chunkManifest
+	if overwrite {
+		old = cc.manifest(item.Key)
+	}
+	it, chunkKeys, err := cc.split(item)
+	if err != nil {
+		return err
+	}
+	if err := store(it); err != nil {
+		cc.deleteChunks(chunkKeys)
+		return err
+	}
+	if old != nil {
+		cc.deleteChunks(old.chunkKeys(item.Key))
+	}
+	return nil
+}
+
+// manifest returns the manifest stored under the given key, or nil if the
+// value is missing or not chunked.
+func (cc *ChunkingClient) manifest(key string) *chunkManifest {
+	item, err := cc.Client.Get(key)
+	if err != nil || item.Flags&chunkFlag == 0 {
+		return nil
+	}
+	var m chunkManifest
+	if !m.unmarshal(item.Value) {
+		return nil
+	}
+	return &m
+}
+
+func (cc *ChunkingClient) deleteChunks(keys []string) {
+	for _, key := range keys {
+		cc.Client.Delete(key)
+	}
+}
+
+// Touch updates the expiry of the item with the provided key and of its
+// chunks.
+func (cc *ChunkingClient) Touch(key string, seconds int32) error {
+	if m := cc.manifest(key); m != nil {
+		for _, chunkKey := range m.chunkKeys(key) {
+			if err := cc.Client.Touch(chunkKey, seconds); err != nil {
+				return err
+			}
+		}
+	}
+	return cc.Client.Touch(key, seconds)
+}
+
+// Delete deletes the item with the provided key and its chunks.
+func (cc *ChunkingClient) Delete(key string) error {
+	item, err := cc.Client.Get(key)
+	if err == nil && item.Flags&chunkFlag != 0 {
+		var m chunkManifest
+		if m.unmarshal(item.Value) {
+			for _, chunkKey := range m.chunkKeys(key) {
+				if err := cc.Client.Delete(chunkKey); err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+					return err
+				}
+			}
+		}
+	}
+	return cc.Client.Delete(key)
+}
+
+// split stores the chunks of a large item and returns its manifest item and
+// the chunk keys, or item itself if it fits in one chunk.
+func (cc *ChunkingClient) split(item *memcache.Item) (*memcache.Item, []string, error) {
+	if len(item.Value) <= cc.opts.ChunkSize {
+		return item, nil, nil
+	}
+	m := chunkManifest{
+		count:  uint32((len(item.Value) + cc.opts.ChunkSize - 1) / cc.opts.ChunkSize),
+		length: uint64(len(item.Value)),
+	}
+	if _, err := rand.Read(m.nonce[:]); err != nil {
+		return nil, nil, err
+	}
+	keys := m.chunkKeys(item.Key)
+	for i, key := range keys {
+		end := (i + 1) * cc.opts.ChunkSize
+		if end > len(item.Value) {
+			end = len(item.Value)
+		}
+		chunk := &memcache.Item{Key: key, Value: item.Value[i*cc.opts.ChunkSize : end], Expiration: item.Expiration}
+		if err := cc.Client.Set(chunk); err != nil {
+			cc.deleteChunks(keys[:i])
+			return nil, nil, err
+		}
+	}
+	it := *item
+	it.Value = m.marshal()
+	it.Flags |= chunkFlag
+	return &it, keys, nil
+}
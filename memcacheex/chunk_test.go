@@ -0,0 +1,182 @@
+package memcacheex
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+func TestChunkingClient(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789"), 25)
+
+	t.Run("SetAndGet", func(t *testing.T) {
+		fc := newFakeClient()
+		cc := NewChunkingClient(fc, ChunkingOptions{ChunkSize: 100})
+
+		item := &memcache.Item{Key: testKey, Value: large, Flags: 1, Expiration: 60}
+		if err := cc.Set(item); err != nil {
+			t.Fatal(err)
+		}
+		if len(fc.items) != 4 {
+			t.Errorf("unexpected number of items: %d", len(fc.items))
+		}
+		for key, it := range fc.items {
+			if strings.Contains(key, ":chunk:") && (len(it.Value) > 100 || it.Expiration != 60) {
+				t.Errorf("unexpected chunk %q: %d bytes, expiration %d", key, len(it.Value), it.Expiration)
+			}
+		}
+
+		got, err := cc.Get(testKey)
+		if err != nil || !bytes.Equal(got.Value, large) || got.Flags != 1 {
+			t.Fatalf("unexpected result: %v, %v", got, err)
+		}
+		gets := fc.called("GetMulti")
+		cc.Set(&memcache.Item{Key: "small", Value: []byte("s")})
+		items, err := cc.GetMulti([]string{testKey, "small", "missing"})
+		if err != nil || len(items) != 2 || !bytes.Equal(items[testKey].Value, large) || string(items["small"].Value) != "s" {
+			t.Errorf("unexpected result: %v, %v", items, err)
+		}
+		if n := fc.called("GetMulti") - gets; n != 2 {
+			t.Errorf("GetMulti was called %d times", n)
+		}
+	})
+
+	t.Run("PartialGetMulti", func(t *testing.T) {
+		pc := &partialClient{fakeClient: newFakeClient(), failures: 1}
+		cc := NewChunkingClient(pc, ChunkingOptions{ChunkSize: 100})
+		cc.Set(&memcache.Item{Key: testKey, Value: large})
+		items, err := cc.GetMulti([]string{testKey})
+		if err != testErr || len(items) != 1 || !bytes.Equal(items[testKey].Value, large) {
+			t.Errorf("unexpected result: %v, %v", items, err)
+		}
+
+		// the chunks cannot be fetched either
+		pc.failures = 2
+		items, err = cc.GetMulti([]string{testKey})
+		if err != testErr || len(items) != 0 {
+			t.Errorf("manifest was returned: %v, %v", items, err)
+		}
+	})
+
+	t.Run("MissingChunkIsMiss", func(t *testing.T) {
+		fc := newFakeClient()
+		cc := NewChunkingClient(fc, ChunkingOptions{ChunkSize: 100})
+		cc.Set(&memcache.Item{Key: testKey, Value: large})
+		for key := range fc.items {
+			if strings.HasSuffix(key, ":1") {
+				fc.Delete(key)
+			}
+		}
+		if _, err := cc.Get(testKey); err != memcache.ErrCacheMiss {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if items, err := cc.GetMulti([]string{testKey}); err != nil || len(items) != 0 {
+			t.Errorf("unexpected result: %v, %v", items, err)
+		}
+	})
+
+	t.Run("OverwriteUsesNewChunks", func(t *testing.T) {
+		fc := newFakeClient()
+		cc := NewChunkingClient(fc, ChunkingOptions{ChunkSize: 100})
+		cc.Set(&memcache.Item{Key: testKey, Value: large})
+		newer := bytes.Repeat([]byte("x"), 150)
+		cc.Set(&memcache.Item{Key: testKey, Value: newer})
+		if got, err := cc.Get(testKey); err != nil || !bytes.Equal(got.Value, newer) {
+			t.Errorf("unexpected result: %v, %v", got, err)
+		}
+		if n := countChunks(fc); n != 2 {
+			t.Errorf("old chunks were left: %d chunks", n)
+		}
+		cc.Set(&memcache.Item{Key: testKey, Value: []byte("small")})
+		if n := countChunks(fc); n != 0 {
+			t.Errorf("old chunks were left: %d chunks", n)
+		}
+	})
+
+	t.Run("FailedWriteCleansUp", func(t *testing.T) {
+		fc := newFakeClient()
+		cc := NewChunkingClient(fc, ChunkingOptions{ChunkSize: 100})
+		cc.Set(&memcache.Item{Key: testKey, Value: large})
+		if err := cc.Add(&memcache.Item{Key: testKey, Value: large}); err != memcache.ErrNotStored {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if err := cc.Replace(&memcache.Item{Key: "missing", Value: large}); err != memcache.ErrNotStored {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if n := countChunks(fc); n != 3 {
+			t.Errorf("chunks of failed writes were left: %d chunks", n)
+		}
+		if got, err := cc.Get(testKey); err != nil || !bytes.Equal(got.Value, large) {
+			t.Errorf("unexpected result: %v, %v", got, err)
+		}
+	})
+
+	t.Run("TouchChunks", func(t *testing.T) {
+		fc := newFakeClient()
+		cc := NewChunkingClient(fc, ChunkingOptions{ChunkSize: 100})
+		cc.Set(&memcache.Item{Key: testKey, Value: large, Expiration: 60})
+		if err := cc.Touch(testKey, 120); err != nil {
+			t.Fatal(err)
+		}
+		for key := range fc.items {
+			if exp := fc.expiration(key); exp != 120 {
+				t.Errorf("%q was not touched: %d", key, exp)
+			}
+		}
+	})
+
+	t.Run("LongKey", func(t *testing.T) {
+		fc := newFakeClient()
+		cc := NewChunkingClient(fc, ChunkingOptions{ChunkSize: 100})
+		key := strings.Repeat("k", maxKeyLength)
+		cc.Set(&memcache.Item{Key: key, Value: large})
+		for k := range fc.items {
+			if len(k) > maxKeyLength {
+				t.Errorf("chunk key too long: %d", len(k))
+			}
+		}
+		if got, err := cc.Get(key); err != nil || !bytes.Equal(got.Value, large) {
+			t.Errorf("unexpected result: %v, %v", got, err)
+		}
+	})
+
+	t.Run("DeleteCleansUp", func(t *testing.T) {
+		fc := newFakeClient()
+		cc := NewChunkingClient(fc, ChunkingOptions{ChunkSize: 100})
+		cc.Set(&memcache.Item{Key: testKey, Value: large})
+		if err := cc.Delete(testKey); err != nil {
+			t.Fatal(err)
+		}
+		if len(fc.items) != 0 {
+			t.Errorf("items were left: %d", len(fc.items))
+		}
+	})
+}
+
+func countChunks(fc *fakeClient) int {
+	n := 0
+	for key := range fc.items {
+		if strings.Contains(key, ":chunk:") {
+			n++
+		}
+	}
+	return n
+}
+
+// partialClient returns the results of GetMulti along with testErr for the
+// given number of calls.
+type partialClient struct {
+	*fakeClient
+	failures int
+}
+
+func (pc *partialClient) GetMulti(keys []string) (map[string]*memcache.Item, error) {
+	items, err := pc.fakeClient.GetMulti(keys)
+	if pc.failures > 0 {
+		pc.failures--
+		return items, testErr
+	}
+	return items, err
+}
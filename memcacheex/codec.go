@@ -0,0 +1,170 @@
+package memcacheex
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// codecFlagMask is the bits of Item.Flags holding the codec ID.
+const codecFlagMask = 0xff
+
+// Codec encodes values stored by SetAs and decodes values read by GetAs.
+// ID is recorded in the low 8 bits of Item.Flags, so that values written
+// with any registered codec can be read. ID 0 is reserved for RawCodec.
+type Codec interface {
+	ID() uint32
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	JSONCodec Codec = jsonCodec{}
+	GobCodec  Codec = gobCodec{}
+	RawCodec  Codec = rawCodec{}
+)
+
+// ErrUnknownCodec is returned by GetAs when the codec ID in Item.Flags is
+// not registered.
+var ErrUnknownCodec = errors.New("memcacheex: unknown codec")
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[uint32]Codec{
+		RawCodec.ID():  RawCodec,
+		JSONCodec.ID(): JSONCodec,
+		GobCodec.ID():  GobCodec,
+	}
+)
+
+// RegisterCodec registers c for decoding by GetAs. It panics if the ID does
+// not fit in 8 bits or is already registered.
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	id := c.ID()
+	if id&^codecFlagMask != 0 {
+		panic(fmt.Sprintf("memcacheex: codec ID %d out of range", id))
+	}
+	if _, ok := codecs[id]; ok {
+		panic(fmt.Sprintf("memcacheex: codec ID %d already registered", id))
+	}
+	codecs[id] = c
+}
+
+func codecFor(flags uint32) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[flags&codecFlagMask]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownCodec, flags&codecFlagMask)
+	}
+	return c, nil
+}
+
+// GetAs gets the item for the given key and decodes it into a T with the
+// codec recorded in its flags. If a schema is registered for T, values of
+// older schema versions are upgraded first.
+func GetAs[T any](c Client, key string) (T, error) {
+	var v T
+	item, err := c.Get(key)
+	if err != nil {
+		return v, err
+	}
+	codec, err := codecFor(item.Flags)
+	if err != nil {
+		return v, err
+	}
+	if s, ok := schemaFor(typeOf[T]()); ok {
+		upgraded, err := upgradeItem(codec, s, item)
+		if err != nil {
+			return v, err
+		}
+		if upgraded && s.Rewrite {
+			item.Expiration = s.RewriteTTL
+			if err := c.CompareAndSwap(item); err != nil && s.OnRewriteError != nil {
+				s.OnRewriteError(key, err)
+			}
+		}
+	}
+	err = codec.Unmarshal(item.Value, &v)
+	return v, err
+}
+
+// SetAs encodes v with JSONCodec and sets it with ttl as the expiration.
+func SetAs[T any](c Client, key string, v T, ttl int32) error {
+	return SetAsWith(c, JSONCodec, key, v, ttl)
+}
+
+// SetAsWith encodes v with codec and sets it with ttl as the expiration.
+// If a schema is registered for T, its version is recorded in the flags.
+func SetAsWith[T any](c Client, codec Codec, key string, v T, ttl int32) error {
+	data, err := codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	flags := codec.ID()
+	if s, ok := schemaFor(typeOf[T]()); ok {
+		flags |= s.Version << schemaFlagShift
+	}
+	return c.Set(&memcache.Item{Key: key, Value: data, Flags: flags, Expiration: ttl})
+}
+
+type rawCodec struct{}
+
+func (rawCodec) ID() uint32 { return 0 }
+
+// Marshal accepts []byte and string.
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case *[]byte:
+		return *v, nil
+	case string:
+		return []byte(v), nil
+	case *string:
+		return []byte(*v), nil
+	}
+	return nil, fmt.Errorf("memcacheex: raw codec cannot marshal %T", v)
+}
+
+// Unmarshal accepts *[]byte and *string.
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	switch v := v.(type) {
+	case *[]byte:
+		*v = data
+		return nil
+	case *string:
+		*v = string(data)
+		return nil
+	}
+	return fmt.Errorf("memcacheex: raw codec cannot unmarshal into %T", v)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ID() uint32                         { return 1 }
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+type gobCodec struct{}
+
+func (gobCodec) ID() uint32 { return 2 }
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
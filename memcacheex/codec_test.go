@@ -0,0 +1,63 @@
+package memcacheex
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+type testUser struct {
+	ID   int
+	Name string
+}
+
+func TestTypedAccessors(t *testing.T) {
+	fc := newFakeClient()
+	want := testUser{ID: 1, Name: "gopher"}
+
+	for _, codec := range []Codec{JSONCodec, GobCodec} {
+		if err := SetAsWith(fc, codec, testKey, want, 60); err != nil {
+			t.Fatal(err)
+		}
+		if item, _ := fc.Get(testKey); item.Flags != codec.ID() || fc.expiration(testKey) != 60 {
+			t.Errorf("unexpected item: %+v, expiration %d", item, fc.expiration(testKey))
+		}
+		got, err := GetAs[testUser](fc, testKey)
+		if err != nil || got != want {
+			t.Errorf("unexpected result with codec %d: %+v, %v", codec.ID(), got, err)
+		}
+	}
+
+	t.Run("DefaultIsJSON", func(t *testing.T) {
+		if err := SetAs(fc, testKey, want, 0); err != nil {
+			t.Fatal(err)
+		}
+		if item, _ := fc.Get(testKey); item.Flags != JSONCodec.ID() || string(item.Value) != `{"ID":1,"Name":"gopher"}` {
+			t.Errorf("unexpected item: %+v", item)
+		}
+	})
+
+	t.Run("Raw", func(t *testing.T) {
+		fc.Set(&memcache.Item{Key: testKey, Value: []byte("plain")})
+		if got, err := GetAs[string](fc, testKey); err != nil || got != "plain" {
+			t.Errorf("unexpected result: %q, %v", got, err)
+		}
+		if _, err := GetAs[testUser](fc, testKey); err == nil {
+			t.Error("raw value was decoded into a struct")
+		}
+	})
+
+	t.Run("UnknownCodec", func(t *testing.T) {
+		fc.Set(&memcache.Item{Key: testKey, Value: []byte("?"), Flags: 0x7f})
+		if _, err := GetAs[testUser](fc, testKey); !errors.Is(err, ErrUnknownCodec) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Miss", func(t *testing.T) {
+		if _, err := GetAs[testUser](fc, "missing"); err != memcache.ErrCacheMiss {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,163 @@
+package memcacheex
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+var _ Client = (*CompressingClient)(nil)
+
+// Compression is an algorithm of CompressingClient. Its value is the bit
+// recorded in Item.Flags for compressed values.
+type Compression uint32
+
+const (
+	// Gzip compresses well.
+	Gzip Compression = 0x100
+	// Flate is faster than Gzip at a lower compression ratio.
+	Flate Compression = 0x200
+
+	compressionFlagMask = 0x300
+)
+
+func (c Compression) String() string {
+	switch c {
+	case Gzip:
+		return "gzip"
+	case Flate:
+		return "flate"
+	}
+	return "unknown"
+}
+
+type CompressionOptions struct {
+	// Algorithm defaults to Gzip.
+	Algorithm Compression
+	// Threshold is the value size above which values are compressed.
+	Threshold int
+}
+
+// CompressingClient compresses values above the threshold on writes and
+// decompresses them on Get and GetMulti. Compressed items are marked by bits
+// 8-9 of Item.Flags, which must not be used by the caller. Values that do not
+// shrink are stored uncompressed, and Increment and Decrement are passed
+// through, so counters keep working.
+type CompressingClient struct {
+	Client
+	opts CompressionOptions
+}
+
+func NewCompressingClient(client Client, opts CompressionOptions) *CompressingClient {
+	if opts.Algorithm == 0 {
+		opts.Algorithm = Gzip
+	}
+	return &CompressingClient{Client: client, opts: opts}
+}
+
+func (cc *CompressingClient) Get(key string) (*memcache.Item, error) {
+	item, err := cc.Client.Get(key)
+	if err != nil {
+		return item, err
+	}
+	if err := decompressItem(item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (cc *CompressingClient) GetMulti(keys []string) (map[string]*memcache.Item, error) {
+	items, err := cc.Client.GetMulti(keys)
+	for _, item := range items {
+		if err := decompressItem(item); err != nil {
+			return nil, err
+		}
+	}
+	return items, err
+}
+
+func (cc *CompressingClient) Set(item *memcache.Item) error {
+	it, err := cc.compressItem(item)
+	if err != nil {
+		return err
+	}
+	return cc.Client.Set(it)
+}
+
+func (cc *CompressingClient) Add(item *memcache.Item) error {
+	it, err := cc.compressItem(item)
+	if err != nil {
+		return err
+	}
+	return cc.Client.Add(it)
+}
+
+func (cc *CompressingClient) Replace(item *memcache.Item) error {
+	it, err := cc.compressItem(item)
+	if err != nil {
+		return err
+	}
+	return cc.Client.Replace(it)
+}
+
+func (cc *CompressingClient) CompareAndSwap(item *memcache.Item) error {
+	it, err := cc.compressItem(item)
+	if err != nil {
+		return err
+	}
+	return cc.Client.CompareAndSwap(it)
+}
+
+// compressItem returns item, or a compressed copy of it.
+func (cc *CompressingClient) compressItem(item *memcache.Item) (*memcache.Item, error) {
+	if len(item.Value) <= cc.opts.Threshold {
+		return item, nil
+	}
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch cc.opts.Algorithm {
+	case Flate:
+		w, _ = flate.NewWriter(&buf, flate.BestSpeed)
+	default:
+		w = gzip.NewWriter(&buf)
+	}
+	if _, err := w.Write(item.Value); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if buf.Len() >= len(item.Value) {
+		return item, nil
+	}
+	it := *item
+	it.Value = buf.Bytes()
+	it.Flags = item.Flags&^compressionFlagMask | uint32(cc.opts.Algorithm)
+	return &it, nil
+}
+
+func decompressItem(item *memcache.Item) error {
+	var r io.ReadCloser
+	switch Compression(item.Flags & compressionFlagMask) {
+	case 0:
+		return nil
+	case Flate:
+		r = flate.NewReader(bytes.NewReader(item.Value))
+	default:
+		var err error
+		if r, err = gzip.NewReader(bytes.NewReader(item.Value)); err != nil {
+			return err
+		}
+	}
+	defer r.Close()
+	value, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	item.Value = value
+	item.Flags &^= compressionFlagMask
+	return nil
+}
@@ -0,0 +1,82 @@
+package memcacheex
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+var testLargeValue = []byte(strings.Repeat(`{"id":1,"name":"gopher","tags":["a","b"]},`, 1000))
+
+func TestCompressingClient(t *testing.T) {
+	for _, algo := range []Compression{Gzip, Flate} {
+		t.Run(algo.String(), func(t *testing.T) {
+			fc := newFakeClient()
+			cc := NewCompressingClient(fc, CompressionOptions{Algorithm: algo, Threshold: 64})
+
+			item := &memcache.Item{Key: testKey, Value: testLargeValue, Flags: 1}
+			if err := cc.Set(item); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(item.Value, testLargeValue) || item.Flags != 1 {
+				t.Error("caller's item was modified")
+			}
+			stored, _ := fc.Get(testKey)
+			if len(stored.Value) >= len(testLargeValue)/5 || stored.Flags != 1|uint32(algo) {
+				t.Errorf("value was not compressed: %d bytes, flags %x", len(stored.Value), stored.Flags)
+			}
+
+			got, err := cc.Get(testKey)
+			if err != nil || !bytes.Equal(got.Value, testLargeValue) || got.Flags != 1 {
+				t.Errorf("unexpected result: %d bytes, flags %x, %v", len(got.Value), got.Flags, err)
+			}
+			items, err := cc.GetMulti([]string{testKey})
+			if err != nil || !bytes.Equal(items[testKey].Value, testLargeValue) {
+				t.Errorf("unexpected result: %v", err)
+			}
+		})
+	}
+
+	t.Run("BelowThreshold", func(t *testing.T) {
+		fc := newFakeClient()
+		cc := NewCompressingClient(fc, CompressionOptions{Threshold: 64})
+		cc.Set(&memcache.Item{Key: testKey, Value: []byte("small")})
+		if stored, _ := fc.Get(testKey); string(stored.Value) != "small" || stored.Flags != 0 {
+			t.Errorf("small value was compressed: %+v", stored)
+		}
+	})
+
+	t.Run("Counters", func(t *testing.T) {
+		fc := newFakeClient()
+		cc := NewCompressingClient(fc, CompressionOptions{})
+		cc.Set(&memcache.Item{Key: testKey, Value: []byte("10")})
+		if v, err := cc.Increment(testKey, 5); err != nil || v != 15 {
+			t.Errorf("unexpected result: %d, %v", v, err)
+		}
+	})
+}
+
+func BenchmarkCompression(b *testing.B) {
+	for _, algo := range []Compression{Gzip, Flate} {
+		cc := NewCompressingClient(newFakeClient(), CompressionOptions{Algorithm: algo})
+		item := &memcache.Item{Key: testKey, Value: testLargeValue}
+
+		b.Run("Compress/"+algo.String(), func(b *testing.B) {
+			b.SetBytes(int64(len(testLargeValue)))
+			for i := 0; i < b.N; i++ {
+				cc.compressItem(item)
+			}
+		})
+
+		compressed, _ := cc.compressItem(item)
+		b.Run("Decompress/"+algo.String(), func(b *testing.B) {
+			b.SetBytes(int64(len(testLargeValue)))
+			for i := 0; i < b.N; i++ {
+				it := *compressed
+				decompressItem(&it)
+			}
+		})
+	}
+}
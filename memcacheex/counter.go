@@ -0,0 +1,86 @@
+package memcacheex
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// ErrCeilingExceeded is returned by IncrementBounded when the counter would
+// exceed its ceiling.
+var ErrCeilingExceeded = errors.New("memcacheex: counter ceiling exceeded")
+
+// counterAttempts is the maximum number of attempts to initialize a counter,
+// which only fails when another writer adds or evicts it in between.
+const counterAttempts = 3
+
+// IncrementOrInit increments the counter for the given key by delta. If the
+// counter does not exist, it is added with initial as the value and ttl as
+// the expiration, and initial is returned.
+func IncrementOrInit(c Client, key string, delta, initial uint64, ttl int32) (uint64, error) {
+	return counterOrInit(c, key, initial, ttl, func() (uint64, error) {
+		return c.Increment(key, delta)
+	})
+}
+
+// AddDelta increments the counter for the given key by a positive delta,
+// or decrements it by a negative one.
+func AddDelta(c Client, key string, delta int64) (uint64, error) {
+	if delta < 0 {
+		return c.Decrement(key, uint64(-delta))
+	}
+	return c.Increment(key, uint64(delta))
+}
+
+// AddDeltaOrInit is AddDelta that initializes missing counters like
+// IncrementOrInit.
+func AddDeltaOrInit(c Client, key string, delta int64, initial uint64, ttl int32) (uint64, error) {
+	return counterOrInit(c, key, initial, ttl, func() (uint64, error) {
+		return AddDelta(c, key, delta)
+	})
+}
+
+func counterOrInit(c Client, key string, initial uint64, ttl int32, op func() (uint64, error)) (uint64, error) {
+	var err error
+	for attempt := 0; attempt < counterAttempts; attempt++ {
+		var v uint64
+		v, err = op()
+		if !errors.Is(err, memcache.ErrCacheMiss) {
+			return v, err
+		}
+		err = c.Add(&memcache.Item{Key: key, Value: []byte(strconv.FormatUint(initial, 10)), Expiration: ttl})
+		if err == nil {
+			return initial, nil
+		}
+		if !errors.Is(err, memcache.ErrNotStored) {
+			return 0, err
+		}
+	}
+	return 0, fmt.Errorf("%w: %v", ErrTooManyAttempts, err)
+}
+
+// IncrementBounded increments the counter for the given key by delta, unless
+// the new value would exceed ceiling, in which case ErrCeilingExceeded is
+// returned and the counter is left as is. Missing counters are added with
+// delta as the value and ttl as the expiration, which increments keep, so
+// that the counter resets when ttl passes, as for a fixed-window rate limit.
+// An increment past the ceiling is undone with Decrement, so concurrent
+// callers may briefly see the counter above the ceiling and be refused too.
+func IncrementBounded(c Client, key string, delta, ceiling uint64, ttl int32) (uint64, error) {
+	if delta > ceiling {
+		return 0, ErrCeilingExceeded
+	}
+	v, err := IncrementOrInit(c, key, delta, delta, ttl)
+	if err != nil {
+		return 0, err
+	}
+	if v > ceiling {
+		if _, err := c.Decrement(key, delta); err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+			return 0, err
+		}
+		return 0, ErrCeilingExceeded
+	}
+	return v, nil
+}
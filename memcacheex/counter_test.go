@@ -0,0 +1,112 @@
+package memcacheex
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/golang/mock/gomock"
+)
+
+func TestCounters(t *testing.T) {
+	t.Run("IncrementOrInit", func(t *testing.T) {
+		fc := newFakeClient()
+		if v, err := IncrementOrInit(fc, testKey, 1, 10, 60); err != nil || v != 10 {
+			t.Errorf("unexpected result: %d, %v", v, err)
+		}
+		if exp := fc.expiration(testKey); exp != 60 {
+			t.Errorf("unexpected expiration: %d", exp)
+		}
+		if v, err := IncrementOrInit(fc, testKey, 1, 10, 60); err != nil || v != 11 {
+			t.Errorf("unexpected result: %d, %v", v, err)
+		}
+	})
+
+	t.Run("IncrementOrInitRace", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		gomock.InOrder(
+			mc.EXPECT().Increment(gomock.Eq(testKey), gomock.Eq(testDelta)).Return(uint64(0), memcache.ErrCacheMiss),
+			mc.EXPECT().Add(gomock.Any()).Return(memcache.ErrNotStored),
+			mc.EXPECT().Increment(gomock.Eq(testKey), gomock.Eq(testDelta)).Return(uint64(2), nil),
+		)
+		if v, err := IncrementOrInit(mc, testKey, testDelta, 1, 0); err != nil || v != 2 {
+			t.Errorf("unexpected result: %d, %v", v, err)
+		}
+	})
+
+	t.Run("AddDelta", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		mc.EXPECT().Increment(gomock.Eq(testKey), gomock.Eq(uint64(3))).Return(uint64(13), nil)
+		mc.EXPECT().Decrement(gomock.Eq(testKey), gomock.Eq(uint64(5))).Return(uint64(8), nil)
+		if v, err := AddDelta(mc, testKey, 3); err != nil || v != 13 {
+			t.Errorf("unexpected result: %d, %v", v, err)
+		}
+		if v, err := AddDelta(mc, testKey, -5); err != nil || v != 8 {
+			t.Errorf("unexpected result: %d, %v", v, err)
+		}
+	})
+
+	t.Run("AddDeltaOrInit", func(t *testing.T) {
+		fc := newFakeClient()
+		if v, err := AddDeltaOrInit(fc, testKey, -1, 5, 0); err != nil || v != 5 {
+			t.Errorf("unexpected result: %d, %v", v, err)
+		}
+		if v, err := AddDeltaOrInit(fc, testKey, -1, 5, 0); err != nil || v != 4 {
+			t.Errorf("unexpected result: %d, %v", v, err)
+		}
+	})
+
+	t.Run("IncrementBoundedAfterDecrement", func(t *testing.T) {
+		fc := newFakeClient()
+		fc.Set(&memcache.Item{Key: testKey, Value: []byte("10")})
+		// memcached leaves "9 " after decrementing 10
+		AddDelta(fc, testKey, -1)
+		if v, err := IncrementBounded(fc, testKey, 1, 10, 0); err != nil || v != 10 {
+			t.Errorf("unexpected result: %d, %v", v, err)
+		}
+	})
+
+	t.Run("IncrementBoundedKeepsTTL", func(t *testing.T) {
+		fc := newFakeClient()
+		IncrementBounded(fc, testKey, 1, 10, 60)
+		IncrementBounded(fc, testKey, 1, 10, 30)
+		if exp := fc.expiration(testKey); exp != 60 {
+			t.Errorf("expiration was extended: %d", exp)
+		}
+	})
+
+	t.Run("IncrementBounded", func(t *testing.T) {
+		fc := newFakeClient()
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var ok, exceeded int
+		for i := 0; i < 15; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := IncrementBounded(fc, testKey, 1, 10, 60)
+				mu.Lock()
+				defer mu.Unlock()
+				switch {
+				case err == nil:
+					ok++
+				case errors.Is(err, ErrCeilingExceeded):
+					exceeded++
+				default:
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+		if exp := fc.expiration(testKey); exp != 60 {
+			t.Errorf("unexpected expiration: %d", exp)
+		}
+		if ok != 10 || exceeded != 5 {
+			t.Errorf("unexpected results: %d ok, %d exceeded", ok, exceeded)
+		}
+		if item, _ := fc.Get(testKey); string(item.Value) != "10" {
+			t.Errorf("unexpected value: %q", item.Value)
+		}
+	})
+}
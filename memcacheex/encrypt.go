@@ -0,0 +1,186 @@
+package memcacheex
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+var _ Client = (*EncryptingClient)(nil)
+
+// encryptionFlag marks encrypted items in Item.Flags.
+const encryptionFlag = 0x400
+
+const encryptionVersion = 1
+
+var (
+	// ErrDecrypt is returned when an encrypted value was tampered with,
+	// or was stored under another key.
+	ErrDecrypt = errors.New("memcacheex: decryption failed")
+	// ErrNotEncrypted is returned when a value is not encrypted and
+	// AllowPlaintext is not set.
+	ErrNotEncrypted = errors.New("memcacheex: value is not encrypted")
+)
+
+type EncryptionKey struct {
+	ID uint32
+	// Key is an AES key of 16, 24 or 32 bytes.
+	Key []byte
+}
+
+type EncryptionOptions struct {
+	// Keys are all keys that values can be decrypted with.
+	Keys []EncryptionKey
+	// ActiveKeyID is the ID of the key new values are encrypted with.
+	ActiveKeyID uint32
+	// AllowPlaintext returns values that are not encrypted as is.
+	AllowPlaintext bool
+}
+
+// EncryptingClient encrypts values with AES-GCM on writes and decrypts them
+// on Get and GetMulti. The envelope holds the ID of the key used, so that
+// keys can be rotated by adding a new active key while old ones are still
+// accepted. The item key is authenticated as associated data, so a value
+// cannot be copied under another key. Encrypted items are marked by bit 10
+// of Item.Flags. Increment and Decrement do not work on encrypted values.
+type EncryptingClient struct {
+	Client
+	opts   EncryptionOptions
+	aeads  map[uint32]cipher.AEAD
+	active cipher.AEAD
+}
+
+func NewEncryptingClient(client Client, opts EncryptionOptions) (*EncryptingClient, error) {
+	ec := &EncryptingClient{
+		Client: client,
+		opts:   opts,
+		aeads:  make(map[uint32]cipher.AEAD, len(opts.Keys)),
+	}
+	for _, k := range opts.Keys {
+		block, err := aes.NewCipher(k.Key)
+		if err != nil {
+			return nil, fmt.Errorf("memcacheex: encryption key %d: %w", k.ID, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("memcacheex: encryption key %d: %w", k.ID, err)
+		}
+		ec.aeads[k.ID] = aead
+	}
+	active, ok := ec.aeads[opts.ActiveKeyID]
+	if !ok {
+		return nil, fmt.Errorf("memcacheex: active encryption key %d not found", opts.ActiveKeyID)
+	}
+	ec.active = active
+	return ec, nil
+}
+
+func (ec *EncryptingClient) Get(key string) (*memcache.Item, error) {
+	item, err := ec.Client.Get(key)
+	if err != nil {
+		return item, err
+	}
+	if err := ec.decryptItem(item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (ec *EncryptingClient) GetMulti(keys []string) (map[string]*memcache.Item, error) {
+	items, err := ec.Client.GetMulti(keys)
+	for _, item := range items {
+		if err := ec.decryptItem(item); err != nil {
+			return nil, err
+		}
+	}
+	return items, err
+}
+
+func (ec *EncryptingClient) Set(item *memcache.Item) error {
+	it, err := ec.encryptItem(item)
+	if err != nil {
+		return err
+	}
+	return ec.Client.Set(it)
+}
+
+func (ec *EncryptingClient) Add(item *memcache.Item) error {
+	it, err := ec.encryptItem(item)
+	if err != nil {
+		return err
+	}
+	return ec.Client.Add(it)
+}
+
+func (ec *EncryptingClient) Replace(item *memcache.Item) error {
+	it, err := ec.encryptItem(item)
+	if err != nil {
+		return err
+	}
+	return ec.Client.Replace(it)
+}
+
+func (ec *EncryptingClient) CompareAndSwap(item *memcache.Item) error {
+	it, err := ec.encryptItem(item)
+	if err != nil {
+		return err
+	}
+	return ec.Client.CompareAndSwap(it)
+}
+
+// associatedData binds a value to its item key and encryption key.
+func associatedData(key string, keyID uint32) []byte {
+	ad := make([]byte, 4, 4+len(key))
+	binary.BigEndian.PutUint32(ad, keyID)
+	return append(ad, key...)
+}
+
+// encryptItem returns an encrypted copy of item. The envelope is
+// version (1 byte), key ID (4 bytes), nonce and sealed value.
+func (ec *EncryptingClient) encryptItem(item *memcache.Item) (*memcache.Item, error) {
+	header := 1 + 4 + ec.active.NonceSize()
+	b := make([]byte, header, header+len(item.Value)+ec.active.Overhead())
+	b[0] = encryptionVersion
+	binary.BigEndian.PutUint32(b[1:], ec.opts.ActiveKeyID)
+	nonce := b[5:header]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	it := *item
+	it.Value = ec.active.Seal(b, nonce, item.Value, associatedData(item.Key, ec.opts.ActiveKeyID))
+	it.Flags |= encryptionFlag
+	return &it, nil
+}
+
+func (ec *EncryptingClient) decryptItem(item *memcache.Item) error {
+	if item.Flags&encryptionFlag == 0 {
+		if ec.opts.AllowPlaintext {
+			return nil
+		}
+		return ErrNotEncrypted
+	}
+	if len(item.Value) < 5 || item.Value[0] != encryptionVersion {
+		return ErrDecrypt
+	}
+	keyID := binary.BigEndian.Uint32(item.Value[1:])
+	aead, ok := ec.aeads[keyID]
+	if !ok {
+		return fmt.Errorf("%w: unknown key %d", ErrDecrypt, keyID)
+	}
+	header := 5 + aead.NonceSize()
+	if len(item.Value) < header {
+		return ErrDecrypt
+	}
+	value, err := aead.Open(nil, item.Value[5:header], item.Value[header:], associatedData(item.Key, keyID))
+	if err != nil {
+		return ErrDecrypt
+	}
+	item.Value = value
+	item.Flags &^= encryptionFlag
+	return nil
+}
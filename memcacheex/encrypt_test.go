@@ -0,0 +1,90 @@
+package memcacheex
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+func TestEncryptingClient(t *testing.T) {
+	key1 := EncryptionKey{ID: 1, Key: bytes.Repeat([]byte{1}, 32)}
+	key2 := EncryptionKey{ID: 2, Key: bytes.Repeat([]byte{2}, 16)}
+	fc := newFakeClient()
+
+	ec1, err := NewEncryptingClient(fc, EncryptionOptions{Keys: []EncryptionKey{key1}, ActiveKeyID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := &memcache.Item{Key: testKey, Value: []byte("secret")}
+	if err := ec1.Set(item); err != nil {
+		t.Fatal(err)
+	}
+	if string(item.Value) != "secret" {
+		t.Error("caller's item was modified")
+	}
+	if stored, _ := fc.Get(testKey); bytes.Contains(stored.Value, []byte("secret")) {
+		t.Error("value was stored in plaintext")
+	}
+	if got, err := ec1.Get(testKey); err != nil || string(got.Value) != "secret" || got.Flags != 0 {
+		t.Errorf("unexpected result: %v, %v", got, err)
+	}
+
+	t.Run("Rotation", func(t *testing.T) {
+		ec2, err := NewEncryptingClient(fc, EncryptionOptions{Keys: []EncryptionKey{key1, key2}, ActiveKeyID: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := ec2.Get(testKey); err != nil || string(got.Value) != "secret" {
+			t.Errorf("value of old key was not decrypted: %v, %v", got, err)
+		}
+		ec2.Set(&memcache.Item{Key: "new", Value: []byte("v2")})
+		items, err := ec2.GetMulti([]string{testKey, "new"})
+		if err != nil || string(items["new"].Value) != "v2" {
+			t.Errorf("unexpected result: %v, %v", items, err)
+		}
+		if _, err := ec1.Get("new"); !errors.Is(err, ErrDecrypt) {
+			t.Errorf("value of unknown key was decrypted: %v", err)
+		}
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		stored, _ := fc.Get(testKey)
+		stored.Value[len(stored.Value)-1] ^= 1
+		fc.Set(stored)
+		if _, err := ec1.Get(testKey); err != ErrDecrypt {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Replayed", func(t *testing.T) {
+		ec1.Set(&memcache.Item{Key: "a", Value: []byte("for a")})
+		stored, _ := fc.Get("a")
+		stored.Key = "b"
+		fc.Set(stored)
+		if _, err := ec1.Get("b"); err != ErrDecrypt {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Plaintext", func(t *testing.T) {
+		fc.Set(&memcache.Item{Key: "plain", Value: []byte("p")})
+		if _, err := ec1.Get("plain"); err != ErrNotEncrypted {
+			t.Errorf("unexpected error: %v", err)
+		}
+		ec, _ := NewEncryptingClient(fc, EncryptionOptions{Keys: []EncryptionKey{key1}, ActiveKeyID: 1, AllowPlaintext: true})
+		if got, err := ec.Get("plain"); err != nil || string(got.Value) != "p" {
+			t.Errorf("unexpected result: %v, %v", got, err)
+		}
+	})
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		if _, err := NewEncryptingClient(fc, EncryptionOptions{Keys: []EncryptionKey{{ID: 1, Key: []byte("short")}}, ActiveKeyID: 1}); err == nil {
+			t.Error("invalid key was accepted")
+		}
+		if _, err := NewEncryptingClient(fc, EncryptionOptions{Keys: []EncryptionKey{key1}, ActiveKeyID: 2}); err == nil {
+			t.Error("missing active key was accepted")
+		}
+	})
+}
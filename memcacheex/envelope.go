@@ -0,0 +1,59 @@
+package memcacheex
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+var errMalformedEnvelope = errors.New("memcacheex: malformed envelope")
+
+// Version 1 envelopes have no delta and are still read with a zero delta.
+const (
+	envelopeMagic   = 0xee
+	envelopeVersion = 2
+	envelopeSize    = 2 + 8 + 8
+	envelopeV1Size  = 2 + 8
+)
+
+// envelope is the value stored by RevalidatingCache and GetOrLoadEarly.
+// SoftExpiry is the time after which the value is stale, Expiration of the
+// item is the hard expiry. A zero SoftExpiry, stored as 0, means the value
+// is never stale. Delta is how long the value took to compute.
+type envelope struct {
+	softExpiry time.Time
+	delta      time.Duration
+	value      []byte
+}
+
+func (e *envelope) marshal() []byte {
+	b := make([]byte, envelopeSize, envelopeSize+len(e.value))
+	b[0] = envelopeMagic
+	b[1] = envelopeVersion
+	if !e.softExpiry.IsZero() {
+		binary.BigEndian.PutUint64(b[2:], uint64(e.softExpiry.UnixNano()))
+	}
+	binary.BigEndian.PutUint64(b[10:], uint64(e.delta))
+	return append(b, e.value...)
+}
+
+func (e *envelope) unmarshal(b []byte) error {
+	if len(b) < envelopeV1Size || b[0] != envelopeMagic {
+		return errMalformedEnvelope
+	}
+	switch {
+	case b[1] == 1:
+		e.delta = 0
+		e.value = b[envelopeV1Size:]
+	case b[1] == envelopeVersion && len(b) >= envelopeSize:
+		e.delta = time.Duration(binary.BigEndian.Uint64(b[10:]))
+		e.value = b[envelopeSize:]
+	default:
+		return errMalformedEnvelope
+	}
+	e.softExpiry = time.Time{}
+	if ns := int64(binary.BigEndian.Uint64(b[2:])); ns != 0 {
+		e.softExpiry = time.Unix(0, ns)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package memcacheex
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEnvelope(t *testing.T) {
+	e := envelope{softExpiry: time.Unix(0, 123456789), delta: time.Second, value: []byte("value")}
+	var got envelope
+	if err := got.unmarshal(e.marshal()); err != nil {
+		t.Fatal(err)
+	}
+	if !got.softExpiry.Equal(e.softExpiry) || got.delta != e.delta || string(got.value) != "value" {
+		t.Errorf("unexpected envelope: %+v", got)
+	}
+	if err := got.unmarshal((&envelope{value: []byte("v")}).marshal()); err != nil || !got.softExpiry.IsZero() {
+		t.Errorf("zero soft expiry was not kept: %v, %v", got.softExpiry, err)
+	}
+	if err := got.unmarshal([]byte("raw")); err != errMalformedEnvelope {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// version 1 has no delta
+	v1 := []byte{envelopeMagic, 1, 0, 0, 0, 0, 0x07, 0x5b, 0xcd, 0x15, 'v'}
+	if err := got.unmarshal(v1); err != nil {
+		t.Fatal(err)
+	}
+	if !got.softExpiry.Equal(e.softExpiry) || got.delta != 0 || string(got.value) != "v" {
+		t.Errorf("unexpected envelope: %+v", got)
+	}
+	if err := got.unmarshal(e.marshal()[:envelopeSize-1]); err != errMalformedEnvelope {
+		t.Errorf("truncated envelope was read: %v", err)
+	}
+}
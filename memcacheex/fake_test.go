@@ -0,0 +1,253 @@
+package memcacheex
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+var _ Client = (*fakeClient)(nil)
+
+// fakeClient is an in-memory Client for tests. It serves the memcached text
+// protocol on a loopback port to a real gomemcache client, so that items
+// carry cas ids and, like with memcached, Get and GetMulti do not return
+// expirations. Expirations are stored but never enforced.
+type fakeClient struct {
+	client *memcache.Client
+
+	mu     sync.Mutex
+	items  map[string]memcache.Item
+	casIDs map[string]uint64
+	cas    uint64
+	calls  map[string]int
+}
+
+func newFakeClient() *fakeClient {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	fc := &fakeClient{
+		client: memcache.New(l.Addr().String()),
+		items:  make(map[string]memcache.Item),
+		casIDs: make(map[string]uint64),
+		calls:  make(map[string]int),
+	}
+	fc.client.Timeout = 10 * time.Second
+	fc.client.MaxIdleConns = 32
+	go fc.serve(l)
+	return fc
+}
+
+func (fc *fakeClient) called(method string) int {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.calls[method]
+}
+
+// expiration returns the stored expiration of the given key.
+func (fc *fakeClient) expiration(key string) int32 {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.items[key].Expiration
+}
+
+// record counts a call once it has returned, so that tests waiting for a
+// call to be counted see its effects.
+func (fc *fakeClient) record(method string) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.calls[method]++
+}
+
+func (fc *fakeClient) FlushAll() error {
+	defer fc.record("FlushAll")
+	return fc.client.FlushAll()
+}
+
+func (fc *fakeClient) Get(key string) (*memcache.Item, error) {
+	defer fc.record("Get")
+	return fc.client.Get(key)
+}
+
+func (fc *fakeClient) Touch(key string, seconds int32) error {
+	defer fc.record("Touch")
+	return fc.client.Touch(key, seconds)
+}
+
+func (fc *fakeClient) GetMulti(keys []string) (map[string]*memcache.Item, error) {
+	defer fc.record("GetMulti")
+	return fc.client.GetMulti(keys)
+}
+
+func (fc *fakeClient) Set(item *memcache.Item) error {
+	defer fc.record("Set")
+	return fc.client.Set(item)
+}
+
+func (fc *fakeClient) Add(item *memcache.Item) error {
+	defer fc.record("Add")
+	return fc.client.Add(item)
+}
+
+func (fc *fakeClient) Replace(item *memcache.Item) error {
+	defer fc.record("Replace")
+	return fc.client.Replace(item)
+}
+
+func (fc *fakeClient) CompareAndSwap(item *memcache.Item) error {
+	defer fc.record("CompareAndSwap")
+	return fc.client.CompareAndSwap(item)
+}
+
+func (fc *fakeClient) Delete(key string) error {
+	defer fc.record("Delete")
+	return fc.client.Delete(key)
+}
+
+func (fc *fakeClient) DeleteAll() error {
+	defer fc.record("DeleteAll")
+	return fc.client.DeleteAll()
+}
+
+func (fc *fakeClient) Ping() error {
+	return fc.client.Ping()
+}
+
+func (fc *fakeClient) Increment(key string, delta uint64) (uint64, error) {
+	defer fc.record("Increment")
+	return fc.client.Increment(key, delta)
+}
+
+func (fc *fakeClient) Decrement(key string, delta uint64) (uint64, error) {
+	defer fc.record("Decrement")
+	return fc.client.Decrement(key, delta)
+}
+
+func (fc *fakeClient) serve(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+			for fc.handle(rw) == nil && rw.Flush() == nil {
+			}
+		}()
+	}
+}
+
+// handle serves one command of the memcached text protocol.
+func (fc *fakeClient) handle(rw *bufio.ReadWriter) error {
+	line, err := rw.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	f := strings.Fields(line)
+	if len(f) == 0 {
+		return fmt.Errorf("empty command")
+	}
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	switch f[0] {
+	case "gets":
+		for _, key := range f[1:] {
+			if it, ok := fc.items[key]; ok {
+				fmt.Fprintf(rw, "VALUE %s %d %d %d\r\n%s\r\n", key, it.Flags, len(it.Value), fc.casIDs[key], it.Value)
+			}
+		}
+		rw.WriteString("END\r\n")
+	case "set", "add", "replace", "cas":
+		flags, _ := strconv.ParseUint(f[2], 10, 32)
+		exp, _ := strconv.ParseInt(f[3], 10, 32)
+		size, _ := strconv.Atoi(f[4])
+		value := make([]byte, size+2)
+		if _, err := io.ReadFull(rw, value); err != nil {
+			return err
+		}
+		item := &memcache.Item{Key: f[1], Value: value[:size], Flags: uint32(flags), Expiration: int32(exp)}
+		_, exists := fc.items[item.Key]
+		switch {
+		case f[0] == "add" && exists, f[0] == "replace" && !exists:
+			rw.WriteString("NOT_STORED\r\n")
+		case f[0] == "cas" && !exists:
+			rw.WriteString("NOT_FOUND\r\n")
+		case f[0] == "cas" && f[5] != strconv.FormatUint(fc.casIDs[item.Key], 10):
+			rw.WriteString("EXISTS\r\n")
+		default:
+			fc.store(item)
+			rw.WriteString("STORED\r\n")
+		}
+	case "delete":
+		if _, ok := fc.items[f[1]]; !ok {
+			rw.WriteString("NOT_FOUND\r\n")
+			break
+		}
+		delete(fc.items, f[1])
+		delete(fc.casIDs, f[1])
+		rw.WriteString("DELETED\r\n")
+	case "incr", "decr":
+		it, ok := fc.items[f[1]]
+		if !ok {
+			rw.WriteString("NOT_FOUND\r\n")
+			break
+		}
+		v, err := strconv.ParseUint(strings.TrimSpace(string(it.Value)), 10, 64)
+		if err != nil {
+			rw.WriteString("CLIENT_ERROR cannot increment or decrement non-numeric value\r\n")
+			break
+		}
+		delta, _ := strconv.ParseUint(f[2], 10, 64)
+		switch {
+		case f[0] == "incr":
+			v += delta
+		case delta > v:
+			v = 0
+		default:
+			v -= delta
+		}
+		// like memcached, pad shrunk values with spaces
+		value := strconv.FormatUint(v, 10)
+		if n := len(it.Value) - len(value); n > 0 {
+			value += strings.Repeat(" ", n)
+		}
+		it.Value = []byte(value)
+		fc.store(&it)
+		fmt.Fprintf(rw, "%d\r\n", v)
+	case "touch":
+		it, ok := fc.items[f[1]]
+		if !ok {
+			rw.WriteString("NOT_FOUND\r\n")
+			break
+		}
+		exp, _ := strconv.ParseInt(f[2], 10, 32)
+		it.Expiration = int32(exp)
+		fc.items[f[1]] = it
+		rw.WriteString("TOUCHED\r\n")
+	case "flush_all":
+		fc.items = make(map[string]memcache.Item)
+		fc.casIDs = make(map[string]uint64)
+		rw.WriteString("OK\r\n")
+	case "version":
+		rw.WriteString("VERSION fake\r\n")
+	default:
+		rw.WriteString("ERROR\r\n")
+	}
+	return nil
+}
+
+func (fc *fakeClient) store(item *memcache.Item) {
+	fc.cas++
+	fc.items[item.Key] = *item
+	fc.casIDs[item.Key] = fc.cas
+}
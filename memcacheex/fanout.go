@@ -0,0 +1,131 @@
+package memcacheex
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+var _ Client = (*FanOutClient)(nil)
+
+// MultiError is a list of errors.
+type MultiError []error
+
+func (me MultiError) Error() string {
+	msgs := make([]string, len(me))
+	for i, err := range me {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("memcacheex: %d errors: %s", len(me), strings.Join(msgs, "; "))
+}
+
+// Is reports whether any of the errors matches target. It lets errors.Is
+// look into a MultiError before Go 1.20, which added Unwrap() []error.
+func (me MultiError) Is(target error) bool {
+	for _, err := range me {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the errors that matches target, like Is.
+func (me MultiError) As(target any) bool {
+	for _, err := range me {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (me MultiError) Unwrap() []error {
+	return me
+}
+
+// ChunkError is an error of GetMulti for a chunk of keys.
+type ChunkError struct {
+	Keys []string
+	Err  error
+}
+
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("memcacheex: GetMulti of %d keys: %v", len(e.Keys), e.Err)
+}
+
+func (e *ChunkError) Unwrap() error {
+	return e.Err
+}
+
+type FanOutOptions struct {
+	// ChunkSize is the maximum number of keys of one GetMulti. Defaults to 100.
+	ChunkSize int
+	// Parallelism is the maximum number of concurrent GetMulti calls.
+	// Defaults to 4.
+	Parallelism int
+}
+
+// FanOutClient splits GetMulti calls with many keys into chunks that are
+// fetched in parallel.
+type FanOutClient struct {
+	Client
+	opts FanOutOptions
+}
+
+func NewFanOutClient(client Client, opts FanOutOptions) *FanOutClient {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = 100
+	}
+	if opts.Parallelism <= 0 {
+		opts.Parallelism = 4
+	}
+	return &FanOutClient{Client: client, opts: opts}
+}
+
+// GetMulti is a batch version of Get. The returned map holds the items of
+// all chunks that were fetched, even if some chunks failed, and the error
+// is a MultiError of *ChunkError for the failed chunks.
+func (fc *FanOutClient) GetMulti(keys []string) (map[string]*memcache.Item, error) {
+	if len(keys) <= fc.opts.ChunkSize {
+		return fc.Client.GetMulti(keys)
+	}
+
+	var (
+		mu    sync.Mutex
+		items = make(map[string]*memcache.Item, len(keys))
+		errs  MultiError
+		wg    sync.WaitGroup
+		sem   = make(chan struct{}, fc.opts.Parallelism)
+	)
+	for start := 0; start < len(keys); start += fc.opts.ChunkSize {
+		end := start + fc.opts.ChunkSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		chunk := keys[start:end]
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fetched, err := fc.Client.GetMulti(chunk)
+			mu.Lock()
+			defer mu.Unlock()
+			for key, item := range fetched {
+				items[key] = item
+			}
+			if err != nil {
+				errs = append(errs, &ChunkError{Keys: chunk, Err: err})
+			}
+		}()
+	}
+	wg.Wait()
+	if errs != nil {
+		return items, errs
+	}
+	return items, nil
+}
@@ -0,0 +1,90 @@
+package memcacheex
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/golang/mock/gomock"
+)
+
+func TestFanOutClient(t *testing.T) {
+	keys := make([]string, 250)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+
+	t.Run("Chunks", func(t *testing.T) {
+		fc := newFakeClient()
+		for _, key := range keys[:200] {
+			fc.Set(&memcache.Item{Key: key, Value: []byte(key)})
+		}
+		foc := NewFanOutClient(fc, FanOutOptions{ChunkSize: 100, Parallelism: 2})
+
+		items, err := foc.GetMulti(keys)
+		if err != nil || len(items) != 200 || string(items["199"].Value) != "199" {
+			t.Errorf("unexpected result: %d items, %v", len(items), err)
+		}
+		if n := fc.called("GetMulti"); n != 3 {
+			t.Errorf("GetMulti was called %d times", n)
+		}
+	})
+
+	t.Run("PartialErrors", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		foc := NewFanOutClient(mc, FanOutOptions{ChunkSize: 100, Parallelism: 4})
+		mc.EXPECT().GetMulti(gomock.Eq(keys[:100])).Return(map[string]*memcache.Item{"0": {Key: "0"}}, nil)
+		mc.EXPECT().GetMulti(gomock.Eq(keys[100:200])).Return(map[string]*memcache.Item{"100": {Key: "100"}}, testErr)
+		mc.EXPECT().GetMulti(gomock.Eq(keys[200:])).Return(nil, testErr)
+
+		items, err := foc.GetMulti(keys)
+		if len(items) != 2 || items["0"] == nil || items["100"] == nil {
+			t.Errorf("unexpected items: %v", items)
+		}
+		var me MultiError
+		if !errors.As(err, &me) || len(me) != 2 {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// called directly, as errors.Is and As also use Unwrap since Go 1.20
+		var ce *ChunkError
+		if !me.Is(testErr) || !me.As(&ce) || ce.Err != testErr {
+			t.Errorf("MultiError did not match its errors: %v", me)
+		}
+		for _, err := range me {
+			var ce *ChunkError
+			if !errors.As(err, &ce) || ce.Err != testErr {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}
+	})
+
+	t.Run("BoundedParallelism", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		foc := NewFanOutClient(mc, FanOutOptions{ChunkSize: 10, Parallelism: 3})
+		var mu sync.Mutex
+		var running, peak int
+		mc.EXPECT().GetMulti(gomock.Any()).Times(25).DoAndReturn(func(keys []string) (map[string]*memcache.Item, error) {
+			mu.Lock()
+			running++
+			if running > peak {
+				peak = running
+			}
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return map[string]*memcache.Item{}, nil
+		})
+
+		if _, err := foc.GetMulti(keys); err != nil {
+			t.Fatal(err)
+		}
+		if peak > 3 {
+			t.Errorf("%d GetMulti calls ran concurrently", peak)
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package memcacheex
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+var _ Client = (*HedgedClient)(nil)
+
+const hedgeLatencyWindow = 128
+
+type HedgeOptions struct {
+	// Delay is how long to wait for the first request before issuing
+	// the hedged one. It is also used while Adaptive has too few samples.
+	Delay time.Duration
+	// Adaptive uses the p95 of recently observed latencies as the delay.
+	Adaptive bool
+	// Budget caps hedged requests as a fraction of all requests.
+	// Zero means no hedging at all.
+	Budget float64
+}
+
+type HedgeStats struct {
+	Requests  uint64
+	Hedges    uint64
+	HedgeWins uint64
+}
+
+// HedgedClient issues a second Get or GetMulti when the first one has not
+// returned within the hedging delay, and returns the first successful result.
+// All other methods are passed through to the underlying client.
+type HedgedClient struct {
+	Client
+	opts HedgeOptions
+
+	requests  uint64
+	hedges    uint64
+	hedgeWins uint64
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	next      int
+}
+
+func NewHedgedClient(client Client, opts HedgeOptions) *HedgedClient {
+	return &HedgedClient{
+		Client:    client,
+		opts:      opts,
+		latencies: make([]time.Duration, 0, hedgeLatencyWindow),
+	}
+}
+
+// Get gets the item for the given key, hedging slow requests.
+func (hc *HedgedClient) Get(key string) (*memcache.Item, error) {
+	res, err := hc.do(func() (any, error) {
+		return hc.Client.Get(key)
+	})
+	item, _ := res.(*memcache.Item)
+	return item, err
+}
+
+// GetMulti is a batch version of Get, hedging slow requests.
+func (hc *HedgedClient) GetMulti(keys []string) (map[string]*memcache.Item, error) {
+	res, err := hc.do(func() (any, error) {
+		return hc.Client.GetMulti(keys)
+	})
+	items, _ := res.(map[string]*memcache.Item)
+	return items, err
+}
+
+// Stats returns a snapshot of the hedging counters.
+func (hc *HedgedClient) Stats() HedgeStats {
+	return HedgeStats{
+		Requests:  atomic.LoadUint64(&hc.requests),
+		Hedges:    atomic.LoadUint64(&hc.hedges),
+		HedgeWins: atomic.LoadUint64(&hc.hedgeWins),
+	}
+}
+
+type hedgeResult struct {
+	val    any
+	err    error
+	hedged bool
+}
+
+func (hc *HedgedClient) do(fn func() (any, error)) (any, error) {
+	atomic.AddUint64(&hc.requests, 1)
+
+	// buffered so that the losing goroutine never blocks
+	ch := make(chan hedgeResult, 2)
+	call := func(hedged bool) {
+		start := time.Now()
+		val, err := fn()
+		if err == nil || errors.Is(err, memcache.ErrCacheMiss) {
+			hc.observe(time.Since(start))
+		}
+		ch <- hedgeResult{val, err, hedged}
+	}
+	go call(false)
+
+	timer := time.NewTimer(hc.delay())
+	defer timer.Stop()
+
+	inflight := 1
+	var last hedgeResult
+	for inflight > 0 {
+		select {
+		case res := <-ch:
+			inflight--
+			if res.err == nil || errors.Is(res.err, memcache.ErrCacheMiss) {
+				if res.hedged {
+					atomic.AddUint64(&hc.hedgeWins, 1)
+				}
+				return res.val, res.err
+			}
+			last = res
+		case <-timer.C:
+			if hc.allowHedge() {
+				inflight++
+				go call(true)
+			}
+		}
+	}
+	return last.val, last.err
+}
+
+func (hc *HedgedClient) allowHedge() bool {
+	if hc.opts.Budget <= 0 {
+		return false
+	}
+	requests := atomic.LoadUint64(&hc.requests)
+	for {
+		hedges := atomic.LoadUint64(&hc.hedges)
+		if float64(hedges+1) > hc.opts.Budget*float64(requests) {
+			return false
+		}
+		if atomic.CompareAndSwapUint64(&hc.hedges, hedges, hedges+1) {
+			return true
+		}
+	}
+}
+
+func (hc *HedgedClient) observe(d time.Duration) {
+	if !hc.opts.Adaptive {
+		return
+	}
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if len(hc.latencies) < hedgeLatencyWindow {
+		hc.latencies = append(hc.latencies, d)
+		return
+	}
+	hc.latencies[hc.next] = d
+	hc.next = (hc.next + 1) % hedgeLatencyWindow
+}
+
+func (hc *HedgedClient) delay() time.Duration {
+	if !hc.opts.Adaptive {
+		return hc.opts.Delay
+	}
+	hc.mu.Lock()
+	if len(hc.latencies) < hedgeLatencyWindow/4 {
+		hc.mu.Unlock()
+		return hc.opts.Delay
+	}
+	sorted := append([]time.Duration(nil), hc.latencies...)
+	hc.mu.Unlock()
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)*95/100]
+}
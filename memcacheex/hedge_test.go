@@ -0,0 +1,76 @@
+package memcacheex
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/golang/mock/gomock"
+)
+
+func TestHedgedClient(t *testing.T) {
+	slowGet := func(key string) (*memcache.Item, error) {
+		time.Sleep(100 * time.Millisecond)
+		return nil, testErr
+	}
+
+	t.Run("HedgeWins", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		hc := NewHedgedClient(mc, HedgeOptions{Delay: time.Millisecond, Budget: 1})
+		mc.EXPECT().Get(gomock.Eq(testKey)).DoAndReturn(slowGet)
+		mc.EXPECT().Get(gomock.Eq(testKey)).Return(testItem, nil)
+
+		item, err := hc.Get(testKey)
+		if err != nil || item != testItem {
+			t.Errorf("unexpected result: %v, %v", item, err)
+		}
+		if s := hc.Stats(); s.Requests != 1 || s.Hedges != 1 || s.HedgeWins != 1 {
+			t.Errorf("unexpected stats: %+v", s)
+		}
+	})
+
+	t.Run("NoHedgeWhenFast", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		hc := NewHedgedClient(mc, HedgeOptions{Delay: time.Second, Budget: 1})
+		mc.EXPECT().GetMulti(gomock.Eq([]string{testKey})).Return(map[string]*memcache.Item{testKey: testItem}, nil)
+
+		items, err := hc.GetMulti([]string{testKey})
+		if err != nil || items[testKey] != testItem {
+			t.Errorf("unexpected result: %v, %v", items, err)
+		}
+		if s := hc.Stats(); s.Hedges != 0 {
+			t.Errorf("unexpected stats: %+v", s)
+		}
+	})
+
+	t.Run("BudgetExhausted", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		hc := NewHedgedClient(mc, HedgeOptions{Delay: time.Millisecond, Budget: 0.5})
+		mc.EXPECT().Get(gomock.Eq(testKey)).DoAndReturn(slowGet)
+
+		if _, err := hc.Get(testKey); err != testErr {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if s := hc.Stats(); s.Hedges != 0 {
+			t.Errorf("unexpected stats: %+v", s)
+		}
+	})
+
+	t.Run("FallbackToOtherResult", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		hc := NewHedgedClient(mc, HedgeOptions{Delay: time.Millisecond, Budget: 1})
+		mc.EXPECT().Get(gomock.Eq(testKey)).DoAndReturn(func(key string) (*memcache.Item, error) {
+			time.Sleep(50 * time.Millisecond)
+			return testItem, nil
+		})
+		mc.EXPECT().Get(gomock.Eq(testKey)).Return(nil, testErr)
+
+		item, err := hc.Get(testKey)
+		if err != nil || item != testItem {
+			t.Errorf("unexpected result: %v, %v", item, err)
+		}
+		if s := hc.Stats(); s.HedgeWins != 0 {
+			t.Errorf("unexpected stats: %+v", s)
+		}
+	})
+}
@@ -5,8 +5,9 @@ import (
 )
 
 var (
-	_ Client = (*memcache.Client)(nil)
-	_ Client = (*ClientWrapper)(nil)
+	_ Client      = (*memcache.Client)(nil)
+	_ Client      = (*ClientWrapper)(nil)
+	_ BatchClient = (*ClientWrapper)(nil)
 )
 
 type Client interface {
@@ -0,0 +1,169 @@
+package memcacheex
+
+import (
+	"sync"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// Invalidation tells peers to evict a key from their near caches.
+// An empty Key means all keys. Evictions are idempotent, so invalidations
+// carry no version and may be delivered more than once or out of order.
+// Races with repopulation are guarded by each NearCache, which does not cache
+// values fetched while their key was invalidated.
+type Invalidation struct {
+	Key string
+}
+
+// InvalidationTransport delivers invalidations between processes.
+// Subscribe returns a function that cancels the subscription.
+type InvalidationTransport interface {
+	Publish(inv Invalidation) error
+	Subscribe(fn func(inv Invalidation)) (unsubscribe func())
+}
+
+var _ InvalidationTransport = (*InProcessTransport)(nil)
+
+// InProcessTransport delivers invalidations synchronously to subscribers
+// in the same process.
+type InProcessTransport struct {
+	mu   sync.RWMutex
+	subs map[int]func(Invalidation)
+	next int
+}
+
+func NewInProcessTransport() *InProcessTransport {
+	return &InProcessTransport{subs: make(map[int]func(Invalidation))}
+}
+
+func (t *InProcessTransport) Publish(inv Invalidation) error {
+	// subscribers are called without the lock, so that they can unsubscribe
+	t.mu.RLock()
+	subs := make([]func(Invalidation), 0, len(t.subs))
+	for _, fn := range t.subs {
+		subs = append(subs, fn)
+	}
+	t.mu.RUnlock()
+	for _, fn := range subs {
+		fn(inv)
+	}
+	return nil
+}
+
+func (t *InProcessTransport) Subscribe(fn func(inv Invalidation)) func() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id := t.next
+	t.next++
+	t.subs[id] = fn
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		delete(t.subs, id)
+	}
+}
+
+const invalidationBusCallback = "memcacheex:invalidation-bus"
+
+// InvalidationBus publishes invalidations for writes made through a
+// ClientWrapper and evicts invalidated keys from attached NearCaches.
+type InvalidationBus struct {
+	transport InvalidationTransport
+
+	// OnError, if set, is called when publishing from a callback fails.
+	OnError func(error)
+}
+
+func NewInvalidationBus(transport InvalidationTransport) *InvalidationBus {
+	return &InvalidationBus{transport: transport}
+}
+
+// Publish invalidates the given key on all peers.
+func (b *InvalidationBus) Publish(key string) error {
+	return b.transport.Publish(Invalidation{Key: key})
+}
+
+// PublishAll invalidates all keys on all peers.
+func (b *InvalidationBus) PublishAll() error {
+	return b.Publish("")
+}
+
+// Attach evicts keys from nc when invalidations are received. The near
+// cache discards values of a key fetched concurrently with an invalidation
+// of that key, so an old value cannot be repopulated after it was
+// invalidated.
+func (b *InvalidationBus) Attach(nc *NearCache) (detach func()) {
+	return b.transport.Subscribe(func(inv Invalidation) {
+		if inv.Key == "" {
+			nc.Purge()
+		} else {
+			nc.Invalidate(inv.Key)
+		}
+	})
+}
+
+// RegisterCallbacks registers After callbacks on cw that publish an
+// invalidation for every successful Set, Add, Delete, Replace,
+// CompareAndSwap, Touch, Increment, Decrement, FlushAll and DeleteAll, and for every key written by SetMulti, DeleteMulti and
+// TouchMulti without an error.
+func (b *InvalidationBus) RegisterCallbacks(cw *ClientWrapper) {
+	item := func(args, results []any) {
+		if results[0] == nil {
+			b.publish(args[0].(*memcache.Item).Key)
+		}
+	}
+	key := func(args, results []any) {
+		if results[0] == nil {
+			b.publish(args[0].(string))
+		}
+	}
+	counter := func(args, results []any) {
+		if results[1] == nil {
+			b.publish(args[0].(string))
+		}
+	}
+	batch := func(keys []string, results []any) {
+		errs := results[0].(map[string]error)
+		for _, key := range keys {
+			if _, failed := errs[key]; !failed {
+				b.publish(key)
+			}
+		}
+	}
+	cr := cw.Callback()
+	cr.Set().After().Register(invalidationBusCallback, item)
+	cr.Add().After().Register(invalidationBusCallback, item)
+	cr.Replace().After().Register(invalidationBusCallback, item)
+	cr.CompareAndSwap().After().Register(invalidationBusCallback, item)
+	cr.Delete().After().Register(invalidationBusCallback, key)
+	cr.Touch().After().Register(invalidationBusCallback, key)
+	cr.Increment().After().Register(invalidationBusCallback, counter)
+	cr.Decrement().After().Register(invalidationBusCallback, counter)
+	cr.SetMulti().After().Register(invalidationBusCallback, func(args, results []any) {
+		items := args[0].([]*memcache.Item)
+		keys := make([]string, len(items))
+		for i, item := range items {
+			keys[i] = item.Key
+		}
+		batch(keys, results)
+	})
+	cr.DeleteMulti().After().Register(invalidationBusCallback, func(args, results []any) {
+		batch(args[0].([]string), results)
+	})
+	cr.TouchMulti().After().Register(invalidationBusCallback, func(args, results []any) {
+		batch(args[0].([]string), results)
+	})
+	all := func(args, results []any) {
+		if results[0] == nil {
+			b.publish("")
+		}
+	}
+	cr.FlushAll().After().Register(invalidationBusCallback, all)
+	cr.DeleteAll().After().Register(invalidationBusCallback, all)
+}
+
+func (b *InvalidationBus) publish(key string) {
+	if err := b.Publish(key); err != nil && b.OnError != nil {
+		b.OnError(err)
+	}
+}
@@ -0,0 +1,149 @@
+package memcacheex
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+func TestInvalidationBus(t *testing.T) {
+	fc := newFakeClient()
+	transport := NewInProcessTransport()
+	opts := NearCacheOptions{MaxEntries: 10, TTL: time.Hour}
+
+	// pod A writes through a ClientWrapper, pod B reads through its near cache
+	ncA := NewNearCache(fc, opts)
+	cwA := NewClientWrapper(ncA)
+	cwA.SetSafetyPolicy(&SafetyPolicy{Allow: true})
+	busA := NewInvalidationBus(transport)
+	busA.RegisterCallbacks(cwA)
+	defer busA.Attach(ncA)()
+
+	innerB := NewClientWrapper(fc)
+	ncB := NewNearCache(innerB, opts)
+	busB := NewInvalidationBus(transport)
+	defer busB.Attach(ncB)()
+
+	var received []Invalidation
+	defer transport.Subscribe(func(inv Invalidation) { received = append(received, inv) })()
+
+	cwA.Set(&memcache.Item{Key: testKey, Value: []byte("1")})
+	ncB.Get(testKey)
+
+	t.Run("Set", func(t *testing.T) {
+		cwA.Set(&memcache.Item{Key: testKey, Value: []byte("2")})
+		if item, _ := ncB.Get(testKey); string(item.Value) != "2" {
+			t.Errorf("stale value: %q", item.Value)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		cwA.Delete(testKey)
+		if _, err := ncB.Get(testKey); err != memcache.ErrCacheMiss {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Counters", func(t *testing.T) {
+		cwA.Add(&memcache.Item{Key: "counter", Value: []byte("1")})
+		ncB.Get("counter")
+		cwA.Increment("counter", 2)
+		if item, _ := ncB.Get("counter"); string(item.Value) != "3" {
+			t.Errorf("stale value after Increment: %q", item.Value)
+		}
+		cwA.Decrement("counter", 1)
+		if item, _ := ncB.Get("counter"); string(item.Value) != "2" {
+			t.Errorf("stale value after Decrement: %q", item.Value)
+		}
+	})
+
+	t.Run("FailedWriteIsNotPublished", func(t *testing.T) {
+		n := len(received)
+		cwA.Replace(&memcache.Item{Key: testKey, Value: []byte("3")})
+		if len(received) != n {
+			t.Errorf("failed Replace was published: %v", received[n:])
+		}
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		cwA.Set(&memcache.Item{Key: "a", Value: []byte("1")})
+		cwA.Set(&memcache.Item{Key: "b", Value: []byte("1")})
+		ncB.Get("a")
+		ncB.Get("b")
+
+		cwA.SetMulti([]*memcache.Item{{Key: "a", Value: []byte("2")}})
+		if item, _ := ncB.Get("a"); string(item.Value) != "2" {
+			t.Errorf("stale value after SetMulti: %q", item.Value)
+		}
+		n := len(received)
+		if errs := cwA.DeleteMulti([]string{"a", "b", "missing"}); len(errs) != 1 {
+			t.Errorf("unexpected errors: %v", errs)
+		}
+		if got := received[n:]; len(got) != 2 || got[0].Key == "missing" || got[1].Key == "missing" {
+			t.Errorf("unexpected invalidations: %+v", got)
+		}
+		for _, key := range []string{"a", "b"} {
+			if _, err := ncB.Get(key); err != memcache.ErrCacheMiss {
+				t.Errorf("unexpected error after DeleteMulti: %v", err)
+			}
+		}
+	})
+
+	t.Run("FlushAll", func(t *testing.T) {
+		for _, flush := range []func() error{cwA.FlushAll, cwA.DeleteAll} {
+			fc.Set(&memcache.Item{Key: testKey, Value: []byte("4")})
+			ncB.Get(testKey)
+			flush()
+			if _, ok := ncB.get(testKey); ok {
+				t.Error("near cache was not purged")
+			}
+			if inv := received[len(received)-1]; inv.Key != "" {
+				t.Errorf("unexpected invalidation: %+v", inv)
+			}
+		}
+	})
+
+	t.Run("InvalidationDuringRepopulation", func(t *testing.T) {
+		fc.Set(&memcache.Item{Key: testKey, Value: []byte("old")})
+		// the invalidation arrives after B fetched the old value from memcached
+		innerB.Callback().Get().After().Register("test", func(args, results []any) {
+			fc.Set(&memcache.Item{Key: testKey, Value: []byte("new")})
+			busA.Publish(testKey)
+		})
+		defer innerB.Callback().Get().After().Unregister("test")
+
+		ncB.Get(testKey)
+		if _, ok := ncB.get(testKey); ok {
+			t.Error("old value was repopulated after invalidation")
+		}
+	})
+
+	t.Run("OtherKeyInvalidatedDuringRepopulation", func(t *testing.T) {
+		fc.Set(&memcache.Item{Key: testKey, Value: []byte("v")})
+		innerB.Callback().Get().After().Register("test", func(args, results []any) {
+			busA.Publish("other")
+		})
+		defer innerB.Callback().Get().After().Unregister("test")
+
+		ncB.Get(testKey)
+		if _, ok := ncB.get(testKey); !ok {
+			t.Error("value was not cached after an invalidation of another key")
+		}
+	})
+}
+
+func TestInProcessTransportUnsubscribeInCallback(t *testing.T) {
+	transport := NewInProcessTransport()
+	var calls int
+	var unsubscribe func()
+	unsubscribe = transport.Subscribe(func(inv Invalidation) {
+		calls++
+		unsubscribe()
+	})
+	transport.Publish(Invalidation{Key: testKey})
+	transport.Publish(Invalidation{Key: testKey})
+	if calls != 1 {
+		t.Errorf("subscriber was called %d times", calls)
+	}
+}
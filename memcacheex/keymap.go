@@ -0,0 +1,130 @@
+package memcacheex
+
+import (
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+var _ Client = (*mappedClient)(nil)
+
+// mappedClient rewrites every key before it is sent to the underlying client
+// and restores the caller's key in returned items. Items passed by the
+// caller are copied, never modified.
+type mappedClient struct {
+	Client
+	mapKey func(key string) (string, error)
+}
+
+func (mc *mappedClient) Get(key string) (*memcache.Item, error) {
+	mapped, err := mc.mapKey(key)
+	if err != nil {
+		return nil, err
+	}
+	item, err := mc.Client.Get(mapped)
+	if item != nil {
+		item.Key = key
+	}
+	return item, err
+}
+
+func (mc *mappedClient) Touch(key string, seconds int32) error {
+	mapped, err := mc.mapKey(key)
+	if err != nil {
+		return err
+	}
+	return mc.Client.Touch(mapped, seconds)
+}
+
+func (mc *mappedClient) GetMulti(keys []string) (map[string]*memcache.Item, error) {
+	mappedKeys := make([]string, len(keys))
+	originals := make(map[string]string, len(keys))
+	for i, key := range keys {
+		mapped, err := mc.mapKey(key)
+		if err != nil {
+			return nil, err
+		}
+		mappedKeys[i] = mapped
+		originals[mapped] = key
+	}
+	items, err := mc.Client.GetMulti(mappedKeys)
+	if items == nil {
+		return nil, err
+	}
+	result := make(map[string]*memcache.Item, len(items))
+	for mapped, item := range items {
+		key, ok := originals[mapped]
+		if !ok {
+			continue
+		}
+		item.Key = key
+		result[key] = item
+	}
+	return result, err
+}
+
+func (mc *mappedClient) Set(item *memcache.Item) error {
+	it, err := mc.mapItem(item)
+	if err != nil {
+		return err
+	}
+	return mc.Client.Set(it)
+}
+
+func (mc *mappedClient) Add(item *memcache.Item) error {
+	it, err := mc.mapItem(item)
+	if err != nil {
+		return err
+	}
+	return mc.Client.Add(it)
+}
+
+func (mc *mappedClient) Replace(item *memcache.Item) error {
+	it, err := mc.mapItem(item)
+	if err != nil {
+		return err
+	}
+	return mc.Client.Replace(it)
+}
+
+func (mc *mappedClient) CompareAndSwap(item *memcache.Item) error {
+	it, err := mc.mapItem(item)
+	if err != nil {
+		return err
+	}
+	return mc.Client.CompareAndSwap(it)
+}
+
+func (mc *mappedClient) Delete(key string) error {
+	mapped, err := mc.mapKey(key)
+	if err != nil {
+		return err
+	}
+	return mc.Client.Delete(mapped)
+}
+
+func (mc *mappedClient) Increment(key string, delta uint64) (uint64, error) {
+	mapped, err := mc.mapKey(key)
+	if err != nil {
+		return 0, err
+	}
+	return mc.Client.Increment(mapped, delta)
+}
+
+func (mc *mappedClient) Decrement(key string, delta uint64) (uint64, error) {
+	mapped, err := mc.mapKey(key)
+	if err != nil {
+		return 0, err
+	}
+	return mc.Client.Decrement(mapped, delta)
+}
+
+// mapItem returns a shallow copy of item with the mapped key. The copy
+// keeps the cas id of item, so it can be passed to CompareAndSwap.
+func (mc *mappedClient) mapItem(item *memcache.Item) (*memcache.Item, error) {
+	mapped, err := mc.mapKey(item.Key)
+	if err != nil {
+		return nil, err
+	}
+	it := *item
+	it.Key = mapped
+	return &it, nil
+}
@@ -0,0 +1,81 @@
+package memcacheex
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const maxKeyLength = 250
+
+// hashedKeySuffixLength is the length of "%h" and a hex SHA-256, which a
+// hashed key ends with.
+const hashedKeySuffixLength = 2 + 2*sha256.Size
+
+// KeyPolicy turns arbitrary strings into keys accepted by memcached.
+// Spaces, control characters and '%' are percent-escaped, and keys still
+// longer than MaxLength are shortened to a readable prefix followed by
+// "%h" and the SHA-256 of the escaped key. Escaped keys never contain
+// "%h", so distinct keys are mapped to distinct keys.
+type KeyPolicy struct {
+	// MaxLength defaults to 250, the limit of memcached. It must leave room
+	// for the hash, that is be at least 66.
+	MaxLength int
+	// ReadablePrefix is the length of the prefix kept in hashed keys.
+	// It defaults to, and is capped at, what fits next to the hash.
+	ReadablePrefix int
+}
+
+// Key returns the memcached key for key.
+func (p KeyPolicy) Key(key string) string {
+	escaped := escapeKey(key)
+	max := p.MaxLength
+	if max <= 0 {
+		max = maxKeyLength
+	}
+	if len(escaped) <= max {
+		return escaped
+	}
+	sum := sha256.Sum256([]byte(escaped))
+	hash := "%h" + hex.EncodeToString(sum[:])
+	prefix := max - hashedKeySuffixLength
+	if p.ReadablePrefix > 0 && p.ReadablePrefix < prefix {
+		prefix = p.ReadablePrefix
+	}
+	if prefix < 0 {
+		prefix = 0
+	}
+	return escaped[:prefix] + hash
+}
+
+func escapeKey(key string) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c <= ' ' || c == 0x7f || c == '%' {
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&0xf])
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// NewKeyPolicyClient returns a Client that maps every key with p. Returned
+// items and the keys of GetMulti results have the caller's original keys.
+// It panics if p.MaxLength is too short for hashed keys.
+func NewKeyPolicyClient(client Client, p KeyPolicy) Client {
+	if p.MaxLength != 0 && (p.MaxLength < hashedKeySuffixLength || p.MaxLength > maxKeyLength) {
+		panic(fmt.Sprintf("memcacheex: key policy MaxLength %d out of range", p.MaxLength))
+	}
+	return &mappedClient{
+		Client: client,
+		mapKey: func(key string) (string, error) {
+			return p.Key(key), nil
+		},
+	}
+}
@@ -0,0 +1,88 @@
+package memcacheex
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+func TestKeyPolicy(t *testing.T) {
+	var p KeyPolicy
+	long := "https://example.com/" + strings.Repeat("a", 300)
+
+	for _, tt := range []struct {
+		key  string
+		want string
+	}{
+		{"plain", "plain"},
+		{"with space", "with%20space"},
+		{"100%", "100%25"},
+		{"tab\tnewline\ndel\x7f", "tab%09newline%0Adel%7F"},
+		{"", ""},
+	} {
+		if got := p.Key(tt.key); got != tt.want {
+			t.Errorf("Key(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+
+	hashed := p.Key(long)
+	if len(hashed) != maxKeyLength || !strings.HasPrefix(hashed, "https://example.com/") || !strings.Contains(hashed, "%h") {
+		t.Errorf("unexpected hashed key: %q", hashed)
+	}
+	if p.Key(long) != hashed {
+		t.Error("hashing is not deterministic")
+	}
+	if p.Key(long+"b") == hashed {
+		t.Error("different keys were hashed to the same key")
+	}
+
+	short := KeyPolicy{ReadablePrefix: 8}.Key(long)
+	if !strings.HasPrefix(short, "https://%h") || len(short) != 8+2+64 {
+		t.Errorf("unexpected hashed key: %q", short)
+	}
+}
+
+func TestKeyPolicyClient(t *testing.T) {
+	fc := newFakeClient()
+	kc := NewKeyPolicyClient(fc, KeyPolicy{})
+	long := strings.Repeat("x", 300)
+	keys := []string{"with space", long}
+
+	for _, key := range keys {
+		if err := kc.Set(&memcache.Item{Key: key, Value: []byte(key[:4])}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	items, err := kc.GetMulti(keys)
+	if err != nil || len(items) != 2 {
+		t.Fatalf("unexpected result: %v, %v", items, err)
+	}
+	for _, key := range keys {
+		if item := items[key]; item == nil || item.Key != key || string(item.Value) != key[:4] {
+			t.Errorf("unexpected item for %q: %v", key, item)
+		}
+	}
+	if _, err := fc.Get("with%20space"); err != nil {
+		t.Errorf("escaped key was not stored: %v", err)
+	}
+}
+
+func TestKeyPolicyClientMaxLength(t *testing.T) {
+	for _, max := range []int{1, hashedKeySuffixLength - 1, maxKeyLength + 1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("MaxLength %d was accepted", max)
+				}
+			}()
+			NewKeyPolicyClient(newFakeClient(), KeyPolicy{MaxLength: max})
+		}()
+	}
+
+	p := KeyPolicy{MaxLength: hashedKeySuffixLength}
+	NewKeyPolicyClient(newFakeClient(), p)
+	if key := p.Key(strings.Repeat("x", 100)); len(key) != hashedKeySuffixLength {
+		t.Errorf("unexpected key: %q", key)
+	}
+}
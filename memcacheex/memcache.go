@@ -7,30 +7,42 @@ import (
 type ClientWrapper struct {
 	client   Client
 	registry *callbackRegistry
+	safety   *SafetyPolicy
+	selector memcache.ServerSelector
 }
 
 func NewClientWrapper(client Client) *ClientWrapper {
 	return &ClientWrapper{
 		client: client,
 		registry: &callbackRegistry{
-			flushAll:       &callbacks{},
-			get:            &callbacks{},
-			touch:          &callbacks{},
-			getMulti:       &callbacks{},
-			set:            &callbacks{},
-			add:            &callbacks{},
-			replace:        &callbacks{},
-			compareAndSwap: &callbacks{},
-			delete:         &callbacks{},
-			deleteAll:      &callbacks{},
-			ping:           &callbacks{},
-			increment:      &callbacks{},
-			decrement:      &callbacks{},
+			flushAll:        &callbacks{},
+			get:             &callbacks{},
+			touch:           &callbacks{},
+			getMulti:        &callbacks{},
+			set:             &callbacks{},
+			add:             &callbacks{},
+			replace:         &callbacks{},
+			compareAndSwap:  &callbacks{},
+			delete:          &callbacks{},
+			deleteAll:       &callbacks{},
+			ping:            &callbacks{},
+			increment:       &callbacks{},
+			decrement:       &callbacks{},
+			setMulti:        &callbacks{},
+			deleteMulti:     &callbacks{},
+			touchMulti:      &callbacks{},
+			getMultiPartial: &callbacks{},
 		},
 	}
 }
 
+// FlushAll flushes all items in the cache. It is blocked unless allowed by
+// a SafetyPolicy, and FlushAllConfirmed passes a confirmation token.
 func (cw *ClientWrapper) FlushAll() error {
+	return cw.FlushAllConfirmed("")
+}
+
+func (cw *ClientWrapper) flushAll() error {
 	for _, cb := range cw.registry.flushAll.befores {
 		cb.fn(nil, nil)
 	}
@@ -154,8 +166,13 @@ func (cw *ClientWrapper) Delete(key string) error {
 	return err
 }
 
-// DeleteAll deletes all items in the cache.
+// DeleteAll deletes all items in the cache. It is blocked unless allowed by
+// a SafetyPolicy, and DeleteAllConfirmed passes a confirmation token.
 func (cw *ClientWrapper) DeleteAll() error {
+	return cw.DeleteAllConfirmed("")
+}
+
+func (cw *ClientWrapper) deleteAll() error {
 	for _, cb := range cw.registry.deleteAll.befores {
 		cb.fn(nil, nil)
 	}
@@ -212,25 +229,81 @@ func (cw *ClientWrapper) Decrement(key string, delta uint64) (uint64, error) {
 	return newValue, err
 }
 
+// SetMulti is a batch version of Set. Items are written in parallel, per
+// server if a ServerSelector is set. The returned map holds the errors of the
+// items that failed by key, and is nil if all items were written.
+func (cw *ClientWrapper) SetMulti(items []*memcache.Item) map[string]error {
+	for _, cb := range cw.registry.setMulti.befores {
+		cb.fn([]any{items}, nil)
+	}
+	keys := make([]string, len(items))
+	for i, item := range items {
+		keys[i] = item.Key
+	}
+	errs := cw.batch(keys, func(i int) error {
+		return cw.client.Set(items[i])
+	})
+	for _, cb := range cw.registry.setMulti.afters {
+		cb.fn([]any{items}, []any{errs})
+	}
+	return errs
+}
+
+// DeleteMulti is a batch version of Delete. Keys are deleted like SetMulti.
+// The returned map holds the errors of the keys that failed, including
+// ErrCacheMiss, and is nil if all keys were deleted.
+func (cw *ClientWrapper) DeleteMulti(keys []string) map[string]error {
+	for _, cb := range cw.registry.deleteMulti.befores {
+		cb.fn([]any{keys}, nil)
+	}
+	errs := cw.batch(keys, func(i int) error {
+		return cw.client.Delete(keys[i])
+	})
+	for _, cb := range cw.registry.deleteMulti.afters {
+		cb.fn([]any{keys}, []any{errs})
+	}
+	return errs
+}
+
+// TouchMulti is a batch version of Touch. Keys are touched like SetMulti.
+// The returned map holds the errors of the keys that failed, including
+// ErrCacheMiss, and is nil if all keys were touched.
+func (cw *ClientWrapper) TouchMulti(keys []string, seconds int32) map[string]error {
+	for _, cb := range cw.registry.touchMulti.befores {
+		cb.fn([]any{keys, seconds}, nil)
+	}
+	errs := cw.batch(keys, func(i int) error {
+		return cw.client.Touch(keys[i], seconds)
+	})
+	for _, cb := range cw.registry.touchMulti.afters {
+		cb.fn([]any{keys, seconds}, []any{errs})
+	}
+	return errs
+}
+
 // Callback returns callbackRegistry
 func (cw *ClientWrapper) Callback() *callbackRegistry {
 	return cw.registry
 }
 
 type callbackRegistry struct {
-	flushAll       *callbacks
-	get            *callbacks
-	touch          *callbacks
-	getMulti       *callbacks
-	set            *callbacks
-	add            *callbacks
-	replace        *callbacks
-	compareAndSwap *callbacks
-	delete         *callbacks
-	deleteAll      *callbacks
-	ping           *callbacks
-	increment      *callbacks
-	decrement      *callbacks
+	flushAll        *callbacks
+	get             *callbacks
+	touch           *callbacks
+	getMulti        *callbacks
+	set             *callbacks
+	add             *callbacks
+	replace         *callbacks
+	compareAndSwap  *callbacks
+	delete          *callbacks
+	deleteAll       *callbacks
+	ping            *callbacks
+	increment       *callbacks
+	decrement       *callbacks
+	setMulti        *callbacks
+	deleteMulti     *callbacks
+	touchMulti      *callbacks
+	getMultiPartial *callbacks
 }
 
 func (cr *callbackRegistry) FlushAll() *callbacks {
@@ -285,6 +358,22 @@ func (cr *callbackRegistry) Decrement() *callbacks {
 	return cr.decrement
 }
 
+func (cr *callbackRegistry) SetMulti() *callbacks {
+	return cr.setMulti
+}
+
+func (cr *callbackRegistry) DeleteMulti() *callbacks {
+	return cr.deleteMulti
+}
+
+func (cr *callbackRegistry) TouchMulti() *callbacks {
+	return cr.touchMulti
+}
+
+func (cr *callbackRegistry) GetMultiPartial() *callbacks {
+	return cr.getMultiPartial
+}
+
 type callbacks struct {
 	befores handlers
 	afters  handlers
@@ -2,6 +2,7 @@ package memcacheex
 
 import (
 	"errors"
+	"sync"
 	"testing"
 
 	"github.com/bradfitz/gomemcache/memcache"
@@ -21,6 +22,7 @@ var (
 func TestClientWrapper(t *testing.T) {
 	mc := NewMockClient(gomock.NewController(t))
 	cw := NewClientWrapper(mc)
+	cw.SetSafetyPolicy(&SafetyPolicy{Allow: true})
 
 	t.Run("FlushAll", func(t *testing.T) {
 		mc.EXPECT().FlushAll().Return(testErr)
@@ -374,4 +376,172 @@ func TestClientWrapper(t *testing.T) {
 			t.Errorf("%s was not unregistered callback, %d", an, l)
 		}
 	})
+
+	t.Run("SetMulti", func(t *testing.T) {
+		mc.EXPECT().Set(gomock.Eq(testItem)).Return(testErr)
+		bn := "SetMulti:Before"
+		an := "SetMulti:After"
+
+		cw.Callback().SetMulti().Before().Register(bn, func(args, results []any) {})
+		cw.Callback().SetMulti().After().Register(an, func(args, results []any) {})
+		cw.SetMulti([]*memcache.Item{testItem})
+
+		if l := len(*cw.Callback().SetMulti().Before()); l != 1 {
+			t.Errorf("%s was not registered callback: %d", bn, l)
+		}
+		if l := len(*cw.Callback().SetMulti().After()); l != 1 {
+			t.Errorf("%s was not registered callback: %d", an, l)
+		}
+
+		cw.Callback().SetMulti().Before().Unregister(bn)
+		cw.Callback().SetMulti().After().Unregister(an)
+
+		if l := len(*cw.Callback().SetMulti().Before()); l != 0 {
+			t.Errorf("%s was not unregistered callback: %d", bn, l)
+		}
+		if l := len(*cw.Callback().SetMulti().After()); l != 0 {
+			t.Errorf("%s was not unregistered callback, %d", an, l)
+		}
+	})
+
+	t.Run("DeleteMulti", func(t *testing.T) {
+		mc.EXPECT().Delete(gomock.Eq(testKey)).Return(testErr)
+		bn := "DeleteMulti:Before"
+		an := "DeleteMulti:After"
+
+		cw.Callback().DeleteMulti().Before().Register(bn, func(args, results []any) {})
+		cw.Callback().DeleteMulti().After().Register(an, func(args, results []any) {})
+		cw.DeleteMulti([]string{testKey})
+
+		if l := len(*cw.Callback().DeleteMulti().Before()); l != 1 {
+			t.Errorf("%s was not registered callback: %d", bn, l)
+		}
+		if l := len(*cw.Callback().DeleteMulti().After()); l != 1 {
+			t.Errorf("%s was not registered callback: %d", an, l)
+		}
+
+		cw.Callback().DeleteMulti().Before().Unregister(bn)
+		cw.Callback().DeleteMulti().After().Unregister(an)
+
+		if l := len(*cw.Callback().DeleteMulti().Before()); l != 0 {
+			t.Errorf("%s was not unregistered callback: %d", bn, l)
+		}
+		if l := len(*cw.Callback().DeleteMulti().After()); l != 0 {
+			t.Errorf("%s was not unregistered callback, %d", an, l)
+		}
+	})
+
+	t.Run("TouchMulti", func(t *testing.T) {
+		testSec := int32(1)
+		mc.EXPECT().Touch(gomock.Eq(testKey), gomock.Eq(testSec)).Return(testErr)
+		bn := "TouchMulti:Before"
+		an := "TouchMulti:After"
+
+		cw.Callback().TouchMulti().Before().Register(bn, func(args, results []any) {})
+		cw.Callback().TouchMulti().After().Register(an, func(args, results []any) {})
+		cw.TouchMulti([]string{testKey}, testSec)
+
+		if l := len(*cw.Callback().TouchMulti().Before()); l != 1 {
+			t.Errorf("%s was not registered callback: %d", bn, l)
+		}
+		if l := len(*cw.Callback().TouchMulti().After()); l != 1 {
+			t.Errorf("%s was not registered callback: %d", an, l)
+		}
+
+		cw.Callback().TouchMulti().Before().Unregister(bn)
+		cw.Callback().TouchMulti().After().Unregister(an)
+
+		if l := len(*cw.Callback().TouchMulti().Before()); l != 0 {
+			t.Errorf("%s was not unregistered callback: %d", bn, l)
+		}
+		if l := len(*cw.Callback().TouchMulti().After()); l != 0 {
+			t.Errorf("%s was not unregistered callback, %d", an, l)
+		}
+	})
+}
+
+func TestClientWrapperBatch(t *testing.T) {
+	mc := NewMockClient(gomock.NewController(t))
+	cw := NewClientWrapper(mc)
+	items := []*memcache.Item{
+		{Key: "a", Value: []byte("a")},
+		{Key: "b", Value: []byte("b")},
+		{Key: "c", Value: []byte("c")},
+	}
+	mc.EXPECT().Set(gomock.Eq(items[0])).Return(nil)
+	mc.EXPECT().Set(gomock.Eq(items[1])).Return(testErr)
+	mc.EXPECT().Set(gomock.Eq(items[2])).Return(nil)
+
+	var calls int
+	var detail map[string]error
+	cw.Callback().SetMulti().After().Register("test", func(args, results []any) {
+		calls++
+		detail = results[0].(map[string]error)
+	})
+
+	errs := cw.SetMulti(items)
+	if len(errs) != 1 || errs["b"] != testErr {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	if calls != 1 || len(detail) != 1 || detail["b"] != testErr {
+		t.Errorf("unexpected callbacks: %d, %v", calls, detail)
+	}
+
+	mc.EXPECT().Delete(gomock.Any()).Return(nil).Times(2)
+	if errs := cw.DeleteMulti([]string{"a", "c"}); errs != nil {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+
+	mc.EXPECT().Touch(gomock.Eq("a"), gomock.Eq(int32(10))).Return(memcache.ErrCacheMiss)
+	if errs := cw.TouchMulti([]string{"a"}, 10); errs["a"] != memcache.ErrCacheMiss {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+}
+
+func TestClientWrapperBatchPerServer(t *testing.T) {
+	ss := new(memcache.ServerList)
+	if err := ss.SetServers("127.0.0.1:11211", "127.0.0.1:11212"); err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	servers := make(map[string]bool)
+	for _, key := range keys {
+		addr, _ := ss.PickServer(key)
+		servers[addr.String()] = true
+	}
+	if len(servers) != 2 {
+		t.Fatal("all keys are on one server")
+	}
+
+	mc := NewMockClient(gomock.NewController(t))
+	cw := NewClientWrapper(mc)
+	cw.SetServerSelector(ss)
+
+	// keys of a server are deleted one after another
+	var mu sync.Mutex
+	inFlight := make(map[string]int)
+	mc.EXPECT().Delete(gomock.Any()).Times(len(keys)).DoAndReturn(func(key string) error {
+		addr, _ := ss.PickServer(key)
+		mu.Lock()
+		inFlight[addr.String()]++
+		n := inFlight[addr.String()]
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inFlight[addr.String()]--
+			mu.Unlock()
+		}()
+		if n > 1 {
+			t.Errorf("%d concurrent requests to %s", n, addr)
+		}
+		if key == "b" {
+			return testErr
+		}
+		return nil
+	})
+
+	errs := cw.DeleteMulti(keys)
+	if len(errs) != 1 || errs["b"] != testErr {
+		t.Errorf("unexpected errors: %v", errs)
+	}
 }
@@ -0,0 +1,167 @@
+package memcacheex
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+const namespaceKeyPrefix = "memcacheex:ns:"
+
+type NamespacesOptions struct {
+	// GenerationTTL is how long a namespace generation is cached in process.
+	// Other processes see an invalidation after at most this long. If zero,
+	// the generation is not cached and every key costs an extra Get.
+	GenerationTTL time.Duration
+}
+
+// Namespaces groups keys into namespaces that can be invalidated at once.
+// Keys are prefixed with the current generation of their namespace, which
+// is stored in memcached and bumped by InvalidateNamespace, so that entries
+// of older generations become unreachable and are evicted in time.
+type Namespaces struct {
+	client Client
+	opts   NamespacesOptions
+	now    func() time.Time
+
+	mu          sync.Mutex
+	generations map[string]namespaceGeneration
+}
+
+type namespaceGeneration struct {
+	gen     string
+	expires time.Time
+}
+
+func NewNamespaces(client Client, opts NamespacesOptions) *Namespaces {
+	return &Namespaces{
+		client:      client,
+		opts:        opts,
+		now:         time.Now,
+		generations: make(map[string]namespaceGeneration),
+	}
+}
+
+// Namespace returns a Client whose keys belong to the given namespace.
+// FlushAll and DeleteAll of the returned Client invalidate the namespace
+// instead of every key in memcached.
+func (n *Namespaces) Namespace(ns string) Client {
+	return &namespaceClient{
+		mappedClient: mappedClient{
+			Client: n.client,
+			mapKey: func(key string) (string, error) {
+				return n.Key(ns, key)
+			},
+		},
+		namespaces: n,
+		ns:         ns,
+	}
+}
+
+var _ Client = (*namespaceClient)(nil)
+
+type namespaceClient struct {
+	mappedClient
+	namespaces *Namespaces
+	ns         string
+}
+
+func (nc *namespaceClient) FlushAll() error {
+	return nc.namespaces.InvalidateNamespace(nc.ns)
+}
+
+func (nc *namespaceClient) DeleteAll() error {
+	return nc.namespaces.InvalidateNamespace(nc.ns)
+}
+
+// Key returns the key in memcached for key in the given namespace.
+func (n *Namespaces) Key(ns, key string) (string, error) {
+	gen, err := n.generation(ns)
+	if err != nil {
+		return "", err
+	}
+	return ns + ":" + gen + ":" + key, nil
+}
+
+// InvalidateNamespace bumps the generation of the given namespace, making all
+// keys of the namespace unreachable.
+func (n *Namespaces) InvalidateNamespace(ns string) error {
+	gen, err := n.client.Increment(namespaceKeyPrefix+ns, 1)
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		// a missing generation is initialized to a new one anyway
+		n.mu.Lock()
+		delete(n.generations, ns)
+		n.mu.Unlock()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// The cached generation is replaced only now, so that a concurrent Key
+	// cannot cache the old generation in between.
+	n.store(ns, strconv.FormatUint(gen, 10))
+	return nil
+}
+
+func (n *Namespaces) generation(ns string) (string, error) {
+	n.mu.Lock()
+	g, ok := n.generations[ns]
+	n.mu.Unlock()
+	if ok && n.now().Before(g.expires) {
+		return g.gen, nil
+	}
+
+	gen, err := n.fetchGeneration(ns)
+	if err != nil {
+		return "", err
+	}
+	return n.store(ns, gen), nil
+}
+
+// store caches gen for ns and returns it, unless a newer generation was
+// cached concurrently, which is returned instead. Generations only grow, so
+// a smaller one was fetched before an invalidation.
+func (n *Namespaces) store(ns, gen string) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if g, ok := n.generations[ns]; ok && n.now().Before(g.expires) && newerGeneration(g.gen, gen) {
+		return g.gen
+	}
+	n.generations[ns] = namespaceGeneration{gen: gen, expires: n.now().Add(n.opts.GenerationTTL)}
+	return gen
+}
+
+func newerGeneration(a, b string) bool {
+	x, errX := strconv.ParseUint(a, 10, 64)
+	y, errY := strconv.ParseUint(b, 10, 64)
+	return errX == nil && errY == nil && x > y
+}
+
+func (n *Namespaces) fetchGeneration(ns string) (string, error) {
+	key := namespaceKeyPrefix + ns
+	// Add fails if another process initialized the generation in between,
+	// then it is read again.
+	for i := 0; i < 3; i++ {
+		item, err := n.client.Get(key)
+		if err == nil {
+			return string(item.Value), nil
+		}
+		if !errors.Is(err, memcache.ErrCacheMiss) {
+			return "", err
+		}
+		// Start from the current time so that an evicted generation is not
+		// reused, which would make stale entries reachable again.
+		gen := strconv.FormatInt(n.now().UnixNano(), 10)
+		err = n.client.Add(&memcache.Item{Key: key, Value: []byte(gen)})
+		if err == nil {
+			return gen, nil
+		}
+		if !errors.Is(err, memcache.ErrNotStored) {
+			return "", err
+		}
+	}
+	return "", memcache.ErrNotStored
+}
@@ -0,0 +1,138 @@
+package memcacheex
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+func TestNamespaces(t *testing.T) {
+	fc := newFakeClient()
+	n := NewNamespaces(fc, NamespacesOptions{GenerationTTL: time.Minute})
+	tenant := n.Namespace("tenant42")
+	other := n.Namespace("tenant43")
+
+	item := &memcache.Item{Key: testKey, Value: []byte("v")}
+	if err := tenant.Set(item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Key != testKey {
+		t.Errorf("caller's item was modified: %q", item.Key)
+	}
+	other.Set(&memcache.Item{Key: testKey, Value: []byte("other")})
+
+	got, err := tenant.Get(testKey)
+	if err != nil || got.Key != testKey || string(got.Value) != "v" {
+		t.Errorf("unexpected result: %v, %v", got, err)
+	}
+	items, err := tenant.GetMulti([]string{testKey})
+	if err != nil || items[testKey] == nil || items[testKey].Key != testKey {
+		t.Errorf("unexpected result: %v, %v", items, err)
+	}
+
+	if err := n.InvalidateNamespace("tenant42"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tenant.Get(testKey); err != memcache.ErrCacheMiss {
+		t.Errorf("invalidated key was reachable: %v", err)
+	}
+	if got, err := other.Get(testKey); err != nil || string(got.Value) != "other" {
+		t.Errorf("other namespace was invalidated: %v, %v", got, err)
+	}
+
+	t.Run("GenerationIsCached", func(t *testing.T) {
+		gets := fc.called("Get")
+		if _, err := n.Key("tenant43", testKey); err != nil {
+			t.Fatal(err)
+		}
+		if fc.called("Get") != gets {
+			t.Error("generation was fetched again")
+		}
+	})
+
+	t.Run("OtherProcessSeesInvalidation", func(t *testing.T) {
+		peer := NewNamespaces(fc, NamespacesOptions{GenerationTTL: time.Minute})
+		now := time.Unix(1600000000, 0)
+		peer.now = func() time.Time { return now }
+		before, _ := peer.Key("tenant43", testKey)
+
+		n.InvalidateNamespace("tenant43")
+		if key, _ := peer.Key("tenant43", testKey); key != before {
+			t.Errorf("generation cache was bypassed: %q", key)
+		}
+		now = now.Add(time.Minute)
+		if key, _ := peer.Key("tenant43", testKey); key == before {
+			t.Errorf("generation was not refreshed: %q", key)
+		}
+	})
+
+	t.Run("CompareAndSwap", func(t *testing.T) {
+		tenant.Set(&memcache.Item{Key: testKey, Value: []byte("1")})
+		item, err := tenant.Get(testKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		item.Value = []byte("2")
+		if err := tenant.CompareAndSwap(item); err != nil {
+			t.Errorf("CompareAndSwap failed: %v", err)
+		}
+		if err := tenant.CompareAndSwap(item); err != memcache.ErrCASConflict {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("FlushAll", func(t *testing.T) {
+		tenant.Set(&memcache.Item{Key: testKey, Value: []byte("v")})
+		other.Set(&memcache.Item{Key: testKey, Value: []byte("other")})
+		if err := tenant.FlushAll(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tenant.Get(testKey); err != memcache.ErrCacheMiss {
+			t.Errorf("flushed key was reachable: %v", err)
+		}
+		if got, err := other.Get(testKey); err != nil || string(got.Value) != "other" {
+			t.Errorf("other namespace was flushed: %v, %v", got, err)
+		}
+		if fc.called("FlushAll") != 0 || fc.called("DeleteAll") != 0 {
+			t.Error("memcached was flushed")
+		}
+	})
+}
+
+func TestNamespacesConcurrentInvalidation(t *testing.T) {
+	fc := newFakeClient()
+	cw := NewClientWrapper(fc)
+	n := NewNamespaces(cw, NamespacesOptions{GenerationTTL: time.Minute})
+
+	t.Run("KeyDuringIncrement", func(t *testing.T) {
+		before, _ := n.Key("ns", testKey)
+		cw.Callback().Increment().Before().Register("test", func(args, results []any) {
+			n.Key("ns", testKey)
+		})
+		defer cw.Callback().Increment().Before().Unregister("test")
+
+		n.InvalidateNamespace("ns")
+		if after, _ := n.Key("ns", testKey); after == before {
+			t.Errorf("invalidated generation is still used: %q", after)
+		}
+	})
+
+	t.Run("FetchBeforeIncrement", func(t *testing.T) {
+		fc.Set(&memcache.Item{Key: namespaceKeyPrefix + "ns2", Value: []byte("1")})
+		// the generation is fetched, then invalidated before it is cached
+		invalidated := false
+		cw.Callback().Get().After().Register("test", func(args, results []any) {
+			if !invalidated {
+				invalidated = true
+				n.InvalidateNamespace("ns2")
+			}
+		})
+		defer cw.Callback().Get().After().Unregister("test")
+
+		n.Key("ns2", testKey)
+		if key, _ := n.Key("ns2", testKey); key != "ns2:2:"+testKey {
+			t.Errorf("invalidated generation is still used: %q", key)
+		}
+	})
+}
@@ -0,0 +1,309 @@
+package memcacheex
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+var _ Client = (*NearCache)(nil)
+
+type NearCacheOptions struct {
+	// MaxEntries is the maximum number of items in the near cache.
+	// Zero means no limit.
+	MaxEntries int
+	// MaxBytes is the maximum total size of keys and values in the near
+	// cache. Zero means no limit.
+	MaxBytes int
+	// TTL is how long an item is kept in the near cache.
+	TTL time.Duration
+}
+
+type NearCacheStats struct {
+	L1Hits uint64
+	L2Hits uint64
+	Misses uint64
+}
+
+// NearCache is an in-process LRU cache in front of a Client. Get and GetMulti
+// read through it, and writes through the NearCache evict the written keys
+// both before and after the write, so that a value read concurrently with
+// the write is not kept.
+// Writes made by other processes are not seen until the TTL passes, unless
+// the near cache is attached to an InvalidationBus.
+type NearCache struct {
+	Client
+	opts NearCacheOptions
+	now  func() time.Time
+
+	l1Hits uint64
+	l2Hits uint64
+	misses uint64
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	bytes   int
+	// fetches tracks keys being fetched from the underlying client. Items
+	// fetched while their key was invalidated, or the cache was purged, are
+	// not cached, as they may predate the invalidation.
+	fetches map[string]*nearFetch
+	epoch   uint64
+}
+
+type nearFetch struct {
+	refs    int
+	version uint64
+}
+
+// nearTicket records the state of a key when its fetch started.
+type nearTicket struct {
+	epoch   uint64
+	version uint64
+}
+
+type nearEntry struct {
+	item    memcache.Item
+	expires time.Time
+}
+
+func (e *nearEntry) size() int {
+	return len(e.item.Key) + len(e.item.Value)
+}
+
+func NewNearCache(client Client, opts NearCacheOptions) *NearCache {
+	return &NearCache{
+		Client:  client,
+		opts:    opts,
+		now:     time.Now,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		fetches: make(map[string]*nearFetch),
+	}
+}
+
+// Get gets the item for the given key from the near cache, or from the
+// underlying client on a near cache miss.
+func (nc *NearCache) Get(key string) (*memcache.Item, error) {
+	item, ok := nc.get(key)
+	if ok {
+		atomic.AddUint64(&nc.l1Hits, 1)
+		return item, nil
+	}
+	ticket := nc.begin(key)
+	item, err := nc.Client.Get(key)
+	if err != nil {
+		nc.end(key, nil, ticket)
+		if err == memcache.ErrCacheMiss {
+			atomic.AddUint64(&nc.misses, 1)
+		}
+		return item, err
+	}
+	atomic.AddUint64(&nc.l2Hits, 1)
+	nc.end(key, item, ticket)
+	return item, nil
+}
+
+// GetMulti is a batch version of Get. Only the keys missing from the near
+// cache are requested from the underlying client.
+func (nc *NearCache) GetMulti(keys []string) (map[string]*memcache.Item, error) {
+	items := make(map[string]*memcache.Item, len(keys))
+	var rest []string
+	for _, key := range keys {
+		item, ok := nc.get(key)
+		if ok {
+			items[key] = item
+		} else {
+			rest = append(rest, key)
+		}
+	}
+	atomic.AddUint64(&nc.l1Hits, uint64(len(items)))
+	if len(rest) == 0 {
+		return items, nil
+	}
+	tickets := make([]nearTicket, len(rest))
+	for i, key := range rest {
+		tickets[i] = nc.begin(key)
+	}
+	fetched, err := nc.Client.GetMulti(rest)
+	for i, key := range rest {
+		nc.end(key, fetched[key], tickets[i])
+	}
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddUint64(&nc.l2Hits, uint64(len(fetched)))
+	atomic.AddUint64(&nc.misses, uint64(len(rest)-len(fetched)))
+	for key, item := range fetched {
+		items[key] = item
+	}
+	return items, nil
+}
+
+func (nc *NearCache) Touch(key string, seconds int32) error {
+	nc.Invalidate(key)
+	defer nc.Invalidate(key)
+	return nc.Client.Touch(key, seconds)
+}
+
+func (nc *NearCache) Set(item *memcache.Item) error {
+	nc.Invalidate(item.Key)
+	defer nc.Invalidate(item.Key)
+	return nc.Client.Set(item)
+}
+
+func (nc *NearCache) Add(item *memcache.Item) error {
+	nc.Invalidate(item.Key)
+	defer nc.Invalidate(item.Key)
+	return nc.Client.Add(item)
+}
+
+func (nc *NearCache) Replace(item *memcache.Item) error {
+	nc.Invalidate(item.Key)
+	defer nc.Invalidate(item.Key)
+	return nc.Client.Replace(item)
+}
+
+func (nc *NearCache) CompareAndSwap(item *memcache.Item) error {
+	nc.Invalidate(item.Key)
+	defer nc.Invalidate(item.Key)
+	return nc.Client.CompareAndSwap(item)
+}
+
+func (nc *NearCache) Delete(key string) error {
+	nc.Invalidate(key)
+	defer nc.Invalidate(key)
+	return nc.Client.Delete(key)
+}
+
+func (nc *NearCache) Increment(key string, delta uint64) (uint64, error) {
+	nc.Invalidate(key)
+	defer nc.Invalidate(key)
+	return nc.Client.Increment(key, delta)
+}
+
+func (nc *NearCache) Decrement(key string, delta uint64) (uint64, error) {
+	nc.Invalidate(key)
+	defer nc.Invalidate(key)
+	return nc.Client.Decrement(key, delta)
+}
+
+func (nc *NearCache) FlushAll() error {
+	nc.Purge()
+	defer nc.Purge()
+	return nc.Client.FlushAll()
+}
+
+func (nc *NearCache) DeleteAll() error {
+	nc.Purge()
+	defer nc.Purge()
+	return nc.Client.DeleteAll()
+}
+
+// Invalidate evicts the given key from the near cache.
+func (nc *NearCache) Invalidate(key string) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	if f, ok := nc.fetches[key]; ok {
+		f.version++
+	}
+	if el, ok := nc.entries[key]; ok {
+		nc.remove(el)
+	}
+}
+
+// Purge evicts all keys from the near cache.
+func (nc *NearCache) Purge() {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	nc.epoch++
+	nc.entries = make(map[string]*list.Element)
+	nc.lru.Init()
+	nc.bytes = 0
+}
+
+// Stats returns a snapshot of the hit counters.
+func (nc *NearCache) Stats() NearCacheStats {
+	return NearCacheStats{
+		L1Hits: atomic.LoadUint64(&nc.l1Hits),
+		L2Hits: atomic.LoadUint64(&nc.l2Hits),
+		Misses: atomic.LoadUint64(&nc.misses),
+	}
+}
+
+// get returns a copy of the cached item, so that callers cannot modify it.
+func (nc *NearCache) get(key string) (*memcache.Item, bool) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	el, ok := nc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*nearEntry)
+	if !nc.now().Before(e.expires) {
+		nc.remove(el)
+		return nil, false
+	}
+	nc.lru.MoveToFront(el)
+	item := e.item
+	item.Value = append([]byte(nil), e.item.Value...)
+	return &item, true
+}
+
+// begin registers a fetch of the given key, which must be ended with end.
+func (nc *NearCache) begin(key string) nearTicket {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	f, ok := nc.fetches[key]
+	if !ok {
+		f = &nearFetch{}
+		nc.fetches[key] = f
+	}
+	f.refs++
+	return nearTicket{epoch: nc.epoch, version: f.version}
+}
+
+// end ends a fetch of the given key and caches item, if not nil, unless the
+// key was invalidated since the fetch began.
+func (nc *NearCache) end(key string, item *memcache.Item, ticket nearTicket) {
+	var e *nearEntry
+	if item != nil {
+		e = &nearEntry{item: *item, expires: nc.now().Add(nc.opts.TTL)}
+		e.item.Value = append([]byte(nil), item.Value...)
+	}
+
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	f := nc.fetches[key]
+	if f.refs--; f.refs == 0 {
+		delete(nc.fetches, key)
+	}
+	if e == nil || f.version != ticket.version || nc.epoch != ticket.epoch {
+		return
+	}
+	nc.put(e)
+}
+
+// put caches e. nc.mu must be held.
+func (nc *NearCache) put(e *nearEntry) {
+	if nc.opts.MaxBytes > 0 && e.size() > nc.opts.MaxBytes {
+		return
+	}
+	if el, ok := nc.entries[e.item.Key]; ok {
+		nc.remove(el)
+	}
+	nc.entries[e.item.Key] = nc.lru.PushFront(e)
+	nc.bytes += e.size()
+	for nc.opts.MaxEntries > 0 && nc.lru.Len() > nc.opts.MaxEntries || nc.opts.MaxBytes > 0 && nc.bytes > nc.opts.MaxBytes {
+		nc.remove(nc.lru.Back())
+	}
+}
+
+func (nc *NearCache) remove(el *list.Element) {
+	e := nc.lru.Remove(el).(*nearEntry)
+	delete(nc.entries, e.item.Key)
+	nc.bytes -= e.size()
+}
@@ -0,0 +1,142 @@
+package memcacheex
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+func TestNearCache(t *testing.T) {
+	fc := newFakeClient()
+	nc := NewNearCache(fc, NearCacheOptions{MaxEntries: 2, TTL: time.Minute})
+	now := time.Unix(1600000000, 0)
+	nc.now = func() time.Time { return now }
+
+	fc.Set(&memcache.Item{Key: "a", Value: []byte("1")})
+	fc.Set(&memcache.Item{Key: "b", Value: []byte("2")})
+	fc.Set(&memcache.Item{Key: "c", Value: []byte("3")})
+
+	t.Run("ReadThrough", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			item, err := nc.Get("a")
+			if err != nil || string(item.Value) != "1" {
+				t.Errorf("unexpected result: %v, %v", item, err)
+			}
+		}
+		if n := fc.called("Get"); n != 1 {
+			t.Errorf("underlying Get was called %d times", n)
+		}
+		if s := nc.Stats(); s.L1Hits != 1 || s.L2Hits != 1 {
+			t.Errorf("unexpected stats: %+v", s)
+		}
+	})
+
+	t.Run("CopiesItems", func(t *testing.T) {
+		item, _ := nc.Get("a")
+		item.Value[0] = 'x'
+		if item, _ := nc.Get("a"); string(item.Value) != "1" {
+			t.Errorf("cached item was modified: %q", item.Value)
+		}
+	})
+
+	t.Run("GetMulti", func(t *testing.T) {
+		items, err := nc.GetMulti([]string{"a", "b", "missing"})
+		if err != nil || len(items) != 2 || string(items["b"].Value) != "2" {
+			t.Errorf("unexpected result: %v, %v", items, err)
+		}
+		if n := fc.called("GetMulti"); n != 1 {
+			t.Errorf("underlying GetMulti was called %d times", n)
+		}
+		if _, err := nc.GetMulti([]string{"a", "b"}); err != nil {
+			t.Fatal(err)
+		}
+		if n := fc.called("GetMulti"); n != 1 {
+			t.Errorf("underlying GetMulti was called %d times", n)
+		}
+	})
+
+	t.Run("EvictsLeastRecentlyUsed", func(t *testing.T) {
+		nc.Get("b")
+		nc.Get("c")
+		if _, ok := nc.get("a"); ok {
+			t.Error("a was not evicted")
+		}
+		if _, ok := nc.get("b"); !ok {
+			t.Error("b was evicted")
+		}
+	})
+
+	t.Run("InvalidatesOnWrite", func(t *testing.T) {
+		nc.Get("b")
+		if err := nc.Set(&memcache.Item{Key: "b", Value: []byte("22")}); err != nil {
+			t.Fatal(err)
+		}
+		if item, _ := nc.Get("b"); string(item.Value) != "22" {
+			t.Errorf("stale item: %q", item.Value)
+		}
+		nc.Delete("b")
+		if _, err := nc.Get("b"); err != memcache.ErrCacheMiss {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Expires", func(t *testing.T) {
+		nc.Get("c")
+		now = now.Add(time.Minute)
+		if _, ok := nc.get("c"); ok {
+			t.Error("c did not expire")
+		}
+	})
+}
+
+func TestNearCacheReadDuringWrite(t *testing.T) {
+	fc := newFakeClient()
+	inner := NewClientWrapper(fc)
+	nc := NewNearCache(inner, NearCacheOptions{MaxEntries: 10, TTL: time.Minute})
+	fc.Set(&memcache.Item{Key: testKey, Value: []byte("old")})
+
+	// another goroutine reads the old value while the Set is in flight
+	inner.Callback().Set().Before().Register("test", func(args, results []any) {
+		nc.Get(testKey)
+	})
+	nc.Set(&memcache.Item{Key: testKey, Value: []byte("new")})
+	if item, err := nc.Get(testKey); err != nil || string(item.Value) != "new" {
+		t.Errorf("unexpected result: %v, %v", item, err)
+	}
+}
+
+func TestNearCacheUnlimited(t *testing.T) {
+	fc := newFakeClient()
+	nc := NewNearCache(fc, NearCacheOptions{TTL: time.Minute})
+	for _, key := range []string{"a", "b", "c"} {
+		fc.Set(&memcache.Item{Key: key, Value: []byte("1")})
+		nc.Get(key)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if _, ok := nc.get(key); !ok {
+			t.Errorf("%s was not cached", key)
+		}
+	}
+}
+
+func TestNearCacheMaxBytes(t *testing.T) {
+	fc := newFakeClient()
+	nc := NewNearCache(fc, NearCacheOptions{MaxEntries: 10, MaxBytes: 10, TTL: time.Minute})
+	fc.Set(&memcache.Item{Key: "a", Value: []byte("1234")})
+	fc.Set(&memcache.Item{Key: "b", Value: []byte("1234")})
+	fc.Set(&memcache.Item{Key: "large", Value: []byte("1234567890")})
+
+	nc.Get("a")
+	nc.Get("b")
+	if _, ok := nc.get("a"); !ok {
+		t.Error("a was evicted")
+	}
+	nc.Get("large")
+	if _, ok := nc.get("large"); ok {
+		t.Error("item larger than MaxBytes was cached")
+	}
+	if nc.bytes != 10 {
+		t.Errorf("unexpected size: %d", nc.bytes)
+	}
+}
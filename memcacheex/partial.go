@@ -0,0 +1,160 @@
+package memcacheex
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// PartialError is returned by GetMultiPartial when some keys could not be
+// fetched. Keys holds the error of every failed key. Servers holds the
+// error of every failed server, if a ServerSelector is set.
+type PartialError struct {
+	Keys    map[string]error
+	Servers map[string]error
+}
+
+func (e *PartialError) Error() string {
+	if len(e.Servers) > 0 {
+		return fmt.Sprintf("memcacheex: GetMulti failed for %d keys on %d servers", len(e.Keys), len(e.Servers))
+	}
+	return fmt.Sprintf("memcacheex: GetMulti failed for %d keys", len(e.Keys))
+}
+
+// SetServerSelector sets the selector of the underlying client, which lets
+// GetMultiPartial fetch keys per server and report errors per server, and
+// SetMulti, DeleteMulti and TouchMulti write keys per server.
+func (cw *ClientWrapper) SetServerSelector(ss memcache.ServerSelector) {
+	cw.selector = ss
+}
+
+// GetMultiPartial is a version of GetMulti that returns the items fetched
+// even if some keys failed, along with a *PartialError for the failures.
+// With a ServerSelector, keys are fetched per server in parallel. Otherwise
+// up to 16 keys missing after a failed GetMulti are fetched one by one to
+// find out which of them failed, and any further missing keys are reported
+// with the error of GetMulti, so that a down server does not cost a round
+// trip per key.
+func (cw *ClientWrapper) GetMultiPartial(keys []string) (map[string]*memcache.Item, error) {
+	for _, cb := range cw.registry.getMultiPartial.befores {
+		cb.fn([]any{keys}, nil)
+	}
+	var items map[string]*memcache.Item
+	var perr *PartialError
+	if cw.selector != nil {
+		items, perr = cw.getMultiPerServer(keys)
+	} else {
+		items, perr = cw.getMultiPerKey(keys)
+	}
+	var err error
+	if perr != nil {
+		err = perr
+	}
+	for _, cb := range cw.registry.getMultiPartial.afters {
+		cb.fn([]any{keys}, []any{items, err})
+	}
+	return items, err
+}
+
+func (cw *ClientWrapper) getMultiPerServer(keys []string) (map[string]*memcache.Item, *PartialError) {
+	items := make(map[string]*memcache.Item, len(keys))
+	var perr *PartialError
+	fail := func(keys []string, server string, err error) {
+		if perr == nil {
+			perr = &PartialError{Keys: make(map[string]error), Servers: make(map[string]error)}
+		}
+		for _, key := range keys {
+			perr.Keys[key] = err
+		}
+		if server != "" {
+			perr.Servers[server] = err
+		}
+	}
+
+	groups := make(map[string][]string)
+	for _, key := range keys {
+		addr, err := cw.selector.PickServer(key)
+		if err != nil {
+			fail([]string{key}, "", err)
+			continue
+		}
+		groups[addr.String()] = append(groups[addr.String()], key)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for server, group := range groups {
+		wg.Add(1)
+		go func(server string, group []string) {
+			defer wg.Done()
+			fetched, err := cw.client.GetMulti(group)
+			mu.Lock()
+			defer mu.Unlock()
+			for key, item := range fetched {
+				items[key] = item
+			}
+			if err != nil {
+				var failed []string
+				for _, key := range group {
+					if _, ok := fetched[key]; !ok {
+						failed = append(failed, key)
+					}
+				}
+				fail(failed, server, err)
+			}
+		}(server, group)
+	}
+	wg.Wait()
+	return items, perr
+}
+
+// maxPartialProbes is the maximum number of keys fetched one by one after a
+// failed GetMulti without a ServerSelector.
+const maxPartialProbes = 16
+
+func (cw *ClientWrapper) getMultiPerKey(keys []string) (map[string]*memcache.Item, *PartialError) {
+	items, err := cw.client.GetMulti(keys)
+	if items == nil {
+		items = make(map[string]*memcache.Item, len(keys))
+	}
+	if err == nil {
+		return items, nil
+	}
+
+	var rest, unprobed []string
+	for _, key := range keys {
+		if _, ok := items[key]; ok {
+			continue
+		}
+		if len(rest) < maxPartialProbes {
+			rest = append(rest, key)
+		} else {
+			unprobed = append(unprobed, key)
+		}
+	}
+	var mu sync.Mutex
+	errs := runBatch(len(rest), func(i int) (string, error) {
+		item, err := cw.client.Get(rest[i])
+		if errors.Is(err, memcache.ErrCacheMiss) {
+			return rest[i], nil
+		}
+		if err == nil {
+			mu.Lock()
+			items[rest[i]] = item
+			mu.Unlock()
+		}
+		return rest[i], err
+	})
+	if len(unprobed) > 0 && errs == nil {
+		errs = make(map[string]error, len(unprobed))
+	}
+	for _, key := range unprobed {
+		errs[key] = err
+	}
+	if errs == nil {
+		return items, nil
+	}
+	return items, &PartialError{Keys: errs}
+}
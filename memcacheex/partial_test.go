@@ -0,0 +1,114 @@
+package memcacheex
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/golang/mock/gomock"
+)
+
+func TestGetMultiPartial(t *testing.T) {
+	t.Run("PerKey", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		cw := NewClientWrapper(mc)
+		keys := []string{"a", "b", "c", "d"}
+		mc.EXPECT().GetMulti(gomock.Eq(keys)).Return(map[string]*memcache.Item{"a": {Key: "a"}}, testErr)
+		mc.EXPECT().Get(gomock.Eq("b")).Return(&memcache.Item{Key: "b"}, nil)
+		mc.EXPECT().Get(gomock.Eq("c")).Return(nil, memcache.ErrCacheMiss)
+		mc.EXPECT().Get(gomock.Eq("d")).Return(nil, testErr)
+
+		var breakdown error
+		cw.Callback().GetMultiPartial().After().Register("test", func(args, results []any) {
+			breakdown, _ = results[1].(error)
+		})
+
+		items, err := cw.GetMultiPartial(keys)
+		if len(items) != 2 || items["a"] == nil || items["b"] == nil {
+			t.Errorf("unexpected items: %v", items)
+		}
+		var perr *PartialError
+		if !errors.As(err, &perr) || len(perr.Keys) != 1 || perr.Keys["d"] != testErr {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if breakdown != err {
+			t.Errorf("callback did not receive the breakdown: %v", breakdown)
+		}
+	})
+
+	t.Run("PerKeyProbesAreCapped", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		cw := NewClientWrapper(mc)
+		keys := make([]string, maxPartialProbes+4)
+		for i := range keys {
+			keys[i] = fmt.Sprintf("key%d", i)
+		}
+		mc.EXPECT().GetMulti(gomock.Eq(keys)).Return(nil, testErr)
+		mc.EXPECT().Get(gomock.Any()).Return(nil, memcache.ErrCacheMiss).Times(maxPartialProbes)
+
+		_, err := cw.GetMultiPartial(keys)
+		var perr *PartialError
+		if !errors.As(err, &perr) || len(perr.Keys) != 4 || perr.Keys[keys[len(keys)-1]] != testErr {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("NoError", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		cw := NewClientWrapper(mc)
+		mc.EXPECT().GetMulti(gomock.Eq([]string{"a"})).Return(map[string]*memcache.Item{}, nil)
+		if items, err := cw.GetMultiPartial([]string{"a"}); err != nil || items == nil {
+			t.Errorf("unexpected result: %v, %v", items, err)
+		}
+	})
+
+	t.Run("PerServer", func(t *testing.T) {
+		ss := new(memcache.ServerList)
+		if err := ss.SetServers("127.0.0.1:11211", "127.0.0.1:11212"); err != nil {
+			t.Fatal(err)
+		}
+		down, err := ss.PickServer("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys, downKeys []string
+		for _, key := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+			keys = append(keys, key)
+			if addr, _ := ss.PickServer(key); addr.String() == down.String() {
+				downKeys = append(downKeys, key)
+			}
+		}
+		if len(downKeys) == len(keys) {
+			t.Fatal("all keys are on one server")
+		}
+
+		mc := NewMockClient(gomock.NewController(t))
+		cw := NewClientWrapper(mc)
+		cw.SetServerSelector(ss)
+		mc.EXPECT().GetMulti(gomock.Any()).Times(2).DoAndReturn(func(keys []string) (map[string]*memcache.Item, error) {
+			if addr, _ := ss.PickServer(keys[0]); addr.String() == down.String() {
+				return map[string]*memcache.Item{}, testErr
+			}
+			items := make(map[string]*memcache.Item)
+			for _, key := range keys {
+				items[key] = &memcache.Item{Key: key}
+			}
+			return items, nil
+		})
+
+		items, err := cw.GetMultiPartial(keys)
+		if len(items) != len(keys)-len(downKeys) {
+			t.Errorf("unexpected items: %v", items)
+		}
+		var perr *PartialError
+		if !errors.As(err, &perr) || len(perr.Servers) != 1 || perr.Servers[down.String()] != testErr {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, key := range downKeys {
+			if perr.Keys[key] != testErr {
+				t.Errorf("error of %q was not reported", key)
+			}
+		}
+	})
+}
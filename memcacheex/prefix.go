@@ -0,0 +1,13 @@
+package memcacheex
+
+// NewPrefixClient returns a Client that prefixes every key with prefix.
+// Returned items and the keys of GetMulti results have the prefix stripped,
+// and items passed to the Client are copied, never modified.
+func NewPrefixClient(client Client, prefix string) Client {
+	return &mappedClient{
+		Client: client,
+		mapKey: func(key string) (string, error) {
+			return prefix + key, nil
+		},
+	}
+}
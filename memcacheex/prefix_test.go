@@ -0,0 +1,57 @@
+package memcacheex
+
+import (
+	"testing"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/golang/mock/gomock"
+)
+
+func TestPrefixClient(t *testing.T) {
+	const prefix = "team:"
+	mc := NewMockClient(gomock.NewController(t))
+	pc := NewPrefixClient(mc, prefix)
+
+	t.Run("Get", func(t *testing.T) {
+		mc.EXPECT().Get(gomock.Eq(prefix+testKey)).Return(&memcache.Item{Key: prefix + testKey}, nil)
+		if item, err := pc.Get(testKey); err != nil || item.Key != testKey {
+			t.Errorf("unexpected result: %v, %v", item, err)
+		}
+	})
+
+	t.Run("GetMulti", func(t *testing.T) {
+		mc.EXPECT().GetMulti(gomock.Eq([]string{prefix + "a", prefix + "b"})).Return(map[string]*memcache.Item{
+			prefix + "a": {Key: prefix + "a"},
+		}, nil)
+		items, err := pc.GetMulti([]string{"a", "b"})
+		if err != nil || len(items) != 1 || items["a"] == nil || items["a"].Key != "a" {
+			t.Errorf("unexpected result: %v, %v", items, err)
+		}
+	})
+
+	t.Run("Set", func(t *testing.T) {
+		item := &memcache.Item{Key: testKey, Value: []byte("v")}
+		mc.EXPECT().Set(gomock.Eq(&memcache.Item{Key: prefix + testKey, Value: []byte("v")})).Return(nil)
+		mc.EXPECT().Add(gomock.Eq(&memcache.Item{Key: prefix + testKey, Value: []byte("v")})).Return(nil)
+		mc.EXPECT().Replace(gomock.Eq(&memcache.Item{Key: prefix + testKey, Value: []byte("v")})).Return(nil)
+		mc.EXPECT().CompareAndSwap(gomock.Eq(&memcache.Item{Key: prefix + testKey, Value: []byte("v")})).Return(nil)
+		pc.Set(item)
+		pc.Add(item)
+		pc.Replace(item)
+		pc.CompareAndSwap(item)
+		if item.Key != testKey {
+			t.Errorf("caller's item was modified: %q", item.Key)
+		}
+	})
+
+	t.Run("Keys", func(t *testing.T) {
+		mc.EXPECT().Touch(gomock.Eq(prefix+testKey), gomock.Eq(int32(1))).Return(nil)
+		mc.EXPECT().Delete(gomock.Eq(prefix + testKey)).Return(nil)
+		mc.EXPECT().Increment(gomock.Eq(prefix+testKey), gomock.Eq(testDelta)).Return(uint64(1), nil)
+		mc.EXPECT().Decrement(gomock.Eq(prefix+testKey), gomock.Eq(testDelta)).Return(uint64(0), nil)
+		pc.Touch(testKey, 1)
+		pc.Delete(testKey)
+		pc.Increment(testKey, testDelta)
+		pc.Decrement(testKey, testDelta)
+	})
+}
@@ -0,0 +1,366 @@
+package memcacheex
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// LoadError is returned by GetOrLoad when the loader fails, so that it can
+// be told apart from errors returned by the cache.
+type LoadError struct {
+	Key string
+	Err error
+}
+
+func (e *LoadError) Error() string {
+	return fmt.Sprintf("memcacheex: load %q: %v", e.Key, e.Err)
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+type ReadThroughOptions struct {
+	// Beta tunes probabilistic early recomputation in GetOrLoadEarly.
+	// Values above 1 favor earlier recomputation. Zero defaults to 1.
+	Beta float64
+	// Rand returns a random number in [0, 1). Defaults to math/rand.Float64.
+	Rand func() float64
+
+	// LeaseTTL is how long a lease taken by GetOrLoadLeased is held at most.
+	// It is rounded up to whole seconds. Zero defaults to 10 seconds.
+	LeaseTTL time.Duration
+	// LeaseMaxWait is how long callers without the lease poll for the value.
+	// Zero defaults to LeaseTTL.
+	LeaseMaxWait time.Duration
+	// LeasePollInterval is the interval of polling. Zero defaults to 50ms.
+	LeasePollInterval time.Duration
+	// StaleTTL, if set, keeps a copy of loaded values for this long, which is
+	// returned to callers waiting for a lease instead of polling.
+	StaleTTL time.Duration
+
+	// NegativeTTL, if set, caches a tombstone for this long when the loader
+	// returns ErrNotFound, so that later reads do not call the loader.
+	// It applies to GetOrLoad and GetOrLoadLeased.
+	NegativeTTL time.Duration
+}
+
+// ErrNotFound is returned by loaders when the value does not exist at the
+// source. ReadThrough then returns a *NotFoundError.
+var ErrNotFound = errors.New("memcacheex: not found")
+
+// NotFoundError is returned by ReadThrough when the loader reported
+// ErrNotFound. Cached is true if it came from a cached tombstone, otherwise
+// Err is the error returned by the loader.
+type NotFoundError struct {
+	Key    string
+	Cached bool
+	Err    error
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("memcacheex: %q not found", e.Key)
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+func (e *NotFoundError) Unwrap() error {
+	return e.Err
+}
+
+// tombstone is the value stored for keys known to be missing.
+var tombstone = []byte("\x00memcacheex:tombstone\x00")
+
+// ErrLeaseTimeout is returned by GetOrLoadLeased when the lease holder did
+// not store the value within LeaseMaxWait.
+var ErrLeaseTimeout = errors.New("memcacheex: timed out waiting for lease")
+
+const (
+	leaseKeySuffix = ":lease"
+	staleKeySuffix = ":stale"
+)
+
+// ReadThrough loads values on cache misses and stores them back to the cache.
+// Concurrent misses for the same key in this process share one loader call.
+type ReadThrough struct {
+	client Client
+	opts   ReadThroughOptions
+	group  flightGroup
+	now    func() time.Time
+	after  func(time.Duration) <-chan time.Time
+}
+
+func NewReadThrough(client Client, opts ReadThroughOptions) *ReadThrough {
+	if opts.Beta == 0 {
+		opts.Beta = 1
+	}
+	if opts.Rand == nil {
+		opts.Rand = rand.Float64
+	}
+	if opts.LeaseTTL == 0 {
+		opts.LeaseTTL = 10 * time.Second
+	}
+	if opts.LeaseMaxWait == 0 {
+		opts.LeaseMaxWait = opts.LeaseTTL
+	}
+	if opts.LeasePollInterval == 0 {
+		opts.LeasePollInterval = 50 * time.Millisecond
+	}
+	return &ReadThrough{client: client, opts: opts, now: time.Now, after: time.After}
+}
+
+// GetOrLoad gets the value for the given key. On ErrCacheMiss the loader is
+// called and its result is set with ttl as the expiration. Loader errors are
+// returned as *LoadError, or *NotFoundError for ErrNotFound, any other error
+// comes from the cache. If storing the loaded value fails, the value is
+// returned along with the error.
+func (rt *ReadThrough) GetOrLoad(ctx context.Context, key string, ttl int32, loader func() ([]byte, error)) ([]byte, error) {
+	item, err := rt.client.Get(key)
+	if err == nil {
+		return rt.hit(item)
+	}
+	if !errors.Is(err, memcache.ErrCacheMiss) {
+		return nil, err
+	}
+	return rt.group.do(ctx, key, func() ([]byte, error) {
+		value, err := loader()
+		if err != nil {
+			return nil, rt.loadError(key, err)
+		}
+		item := &memcache.Item{Key: key, Value: value, Expiration: ttl}
+		return value, rt.client.Set(item)
+	})
+}
+
+func (rt *ReadThrough) hit(item *memcache.Item) ([]byte, error) {
+	if bytes.Equal(item.Value, tombstone) {
+		return nil, &NotFoundError{Key: item.Key, Cached: true}
+	}
+	return item.Value, nil
+}
+
+// loadError is like the package-level loadError, but also caches a
+// tombstone for ErrNotFound.
+func (rt *ReadThrough) loadError(key string, err error) error {
+	if errors.Is(err, ErrNotFound) && rt.opts.NegativeTTL > 0 {
+		rt.client.Set(&memcache.Item{
+			Key:        key,
+			Value:      tombstone,
+			Expiration: seconds(rt.opts.NegativeTTL),
+		})
+	}
+	return loadError(key, err)
+}
+
+// loadError wraps an error of a loader in *NotFoundError for ErrNotFound and
+// in *LoadError otherwise.
+func loadError(key string, err error) error {
+	if errors.Is(err, ErrNotFound) {
+		return &NotFoundError{Key: key, Err: err}
+	}
+	return &LoadError{Key: key, Err: err}
+}
+
+// GetOrLoadEarly is GetOrLoad with probabilistic early recomputation
+// (XFetch). The value is stored in an envelope with its expiry and the time
+// the loader took, and each caller recomputes before the expiry with a
+// probability that grows as the expiry approaches and with the compute time.
+// If an early recomputation fails, the cached value is returned.
+// Values stored by GetOrLoadEarly must not be read by GetOrLoad.
+func (rt *ReadThrough) GetOrLoadEarly(ctx context.Context, key string, ttl int32, loader func() ([]byte, error)) ([]byte, error) {
+	item, err := rt.client.Get(key)
+	if err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+		return nil, err
+	}
+	var e envelope
+	if err == nil && e.unmarshal(item.Value) == nil {
+		if !rt.shouldRecompute(&e) {
+			return e.value, nil
+		}
+		if value, err := rt.group.do(ctx, key, rt.loadEnvelope(key, ttl, loader)); err == nil {
+			return value, nil
+		}
+		return e.value, nil
+	}
+	return rt.group.do(ctx, key, rt.loadEnvelope(key, ttl, loader))
+}
+
+func (rt *ReadThrough) shouldRecompute(e *envelope) bool {
+	if e.softExpiry.IsZero() {
+		return false
+	}
+	// -log(1-r) is in [0, +Inf) for r in [0, 1)
+	gap := float64(e.delta) * rt.opts.Beta * -math.Log(1-rt.opts.Rand())
+	return !rt.now().Add(time.Duration(gap)).Before(e.softExpiry)
+}
+
+func (rt *ReadThrough) loadEnvelope(key string, ttl int32, loader func() ([]byte, error)) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		start := rt.now()
+		value, err := loader()
+		if err != nil {
+			return nil, loadError(key, err)
+		}
+		e := envelope{delta: rt.now().Sub(start), value: value}
+		if ttl > 0 {
+			e.softExpiry = start.Add(time.Duration(ttl) * time.Second)
+		}
+		item := &memcache.Item{Key: key, Value: e.marshal(), Expiration: ttl}
+		return value, rt.client.Set(item)
+	}
+}
+
+// GetOrLoadLeased is GetOrLoad that also dedupes misses across processes.
+// The first caller to miss takes a lease by adding a lease key with a random
+// token and calls the loader, unless the value was stored in between. The
+// lease is released only if it still holds the token, so that a loader
+// running longer than LeaseTTL does not release the lease of another caller.
+// Other callers return the stale copy if StaleTTL is set and one exists, or
+// poll for the value until LeaseMaxWait and then return ErrLeaseTimeout.
+func (rt *ReadThrough) GetOrLoadLeased(ctx context.Context, key string, ttl int32, loader func() ([]byte, error)) ([]byte, error) {
+	item, err := rt.client.Get(key)
+	if err == nil {
+		return rt.hit(item)
+	}
+	if !errors.Is(err, memcache.ErrCacheMiss) {
+		return nil, err
+	}
+	// The flight is shared by all callers, so it polls regardless of the
+	// ctx of any one of them, bounded by LeaseMaxWait.
+	return rt.group.do(ctx, key, func() ([]byte, error) {
+		return rt.leased(key, ttl, loader)
+	})
+}
+
+func (rt *ReadThrough) leased(key string, ttl int32, loader func() ([]byte, error)) ([]byte, error) {
+	leaseKey := key + leaseKeySuffix
+	token := make([]byte, 16)
+	if _, err := crand.Read(token); err != nil {
+		return nil, err
+	}
+	err := rt.client.Add(&memcache.Item{
+		Key:        leaseKey,
+		Value:      token,
+		Expiration: seconds(rt.opts.LeaseTTL),
+	})
+	if err == nil {
+		defer rt.releaseLease(leaseKey, token)
+		item, err := rt.client.Get(key)
+		if err == nil {
+			return rt.hit(item)
+		}
+		if !errors.Is(err, memcache.ErrCacheMiss) {
+			return nil, err
+		}
+		value, err := loader()
+		if err != nil {
+			return nil, rt.loadError(key, err)
+		}
+		if rt.opts.StaleTTL > 0 {
+			rt.client.Set(&memcache.Item{
+				Key:        key + staleKeySuffix,
+				Value:      value,
+				Expiration: seconds(rt.opts.StaleTTL),
+			})
+		}
+		item = &memcache.Item{Key: key, Value: value, Expiration: ttl}
+		return value, rt.client.Set(item)
+	}
+	if !errors.Is(err, memcache.ErrNotStored) {
+		return nil, err
+	}
+
+	if rt.opts.StaleTTL > 0 {
+		if item, err := rt.client.Get(key + staleKeySuffix); err == nil {
+			return item.Value, nil
+		}
+	}
+	deadline := rt.now().Add(rt.opts.LeaseMaxWait)
+	for rt.now().Before(deadline) {
+		<-rt.after(rt.opts.LeasePollInterval)
+		item, err := rt.client.Get(key)
+		if err == nil {
+			return rt.hit(item)
+		}
+		if !errors.Is(err, memcache.ErrCacheMiss) {
+			return nil, err
+		}
+	}
+	return nil, ErrLeaseTimeout
+}
+
+// releaseLease deletes the lease key if it still holds token. The lease can
+// still expire and be taken between the Get and the Delete, which is far less
+// likely than a loader outliving LeaseTTL.
+func (rt *ReadThrough) releaseLease(leaseKey string, token []byte) {
+	item, err := rt.client.Get(leaseKey)
+	if err == nil && bytes.Equal(item.Value, token) {
+		rt.client.Delete(leaseKey)
+	}
+}
+
+// seconds converts d to an expiration, rounding up to whole seconds.
+func seconds(d time.Duration) int32 {
+	return int32((d + time.Second - 1) / time.Second)
+}
+
+type flight struct {
+	done chan struct{}
+	val  []byte
+	err  error
+}
+
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+	joined  func(key string) // for tests, called when a caller joined a flight
+}
+
+// do calls fn once for concurrent callers with the same key. fn runs in its
+// own goroutine so that each caller can stop waiting when its ctx is done.
+func (g *flightGroup) do(ctx context.Context, key string, fn func() ([]byte, error)) ([]byte, error) {
+	f := g.start(key, fn)
+	select {
+	case <-f.done:
+		return f.val, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// start joins the flight for key, starting fn in its own goroutine if there
+// is none, without waiting for it.
+func (g *flightGroup) start(key string, fn func() ([]byte, error)) *flight {
+	g.mu.Lock()
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	f, ok := g.flights[key]
+	if !ok {
+		f = &flight{done: make(chan struct{})}
+		g.flights[key] = f
+		go func() {
+			f.val, f.err = fn()
+			g.mu.Lock()
+			delete(g.flights, key)
+			g.mu.Unlock()
+			close(f.done)
+		}()
+	}
+	g.mu.Unlock()
+	if g.joined != nil {
+		g.joined(key)
+	}
+	return f
+}
@@ -0,0 +1,431 @@
+package memcacheex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/golang/mock/gomock"
+)
+
+func TestReadThrough(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Hit", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		rt := NewReadThrough(mc, ReadThroughOptions{})
+		mc.EXPECT().Get(gomock.Eq(testKey)).Return(testItem, nil)
+
+		v, err := rt.GetOrLoad(ctx, testKey, 60, func() ([]byte, error) {
+			t.Error("loader was called on hit")
+			return nil, nil
+		})
+		if err != nil || string(v) != "test" {
+			t.Errorf("unexpected result: %q, %v", v, err)
+		}
+	})
+
+	t.Run("MissLoadsAndSets", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		rt := NewReadThrough(mc, ReadThroughOptions{})
+		mc.EXPECT().Get(gomock.Eq(testKey)).Return(nil, memcache.ErrCacheMiss)
+		mc.EXPECT().Set(gomock.Eq(&memcache.Item{Key: testKey, Value: []byte("loaded"), Expiration: 60})).Return(nil)
+
+		v, err := rt.GetOrLoad(ctx, testKey, 60, func() ([]byte, error) {
+			return []byte("loaded"), nil
+		})
+		if err != nil || string(v) != "loaded" {
+			t.Errorf("unexpected result: %q, %v", v, err)
+		}
+	})
+
+	t.Run("LoaderError", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		rt := NewReadThrough(mc, ReadThroughOptions{})
+		mc.EXPECT().Get(gomock.Eq(testKey)).Return(nil, memcache.ErrCacheMiss)
+
+		_, err := rt.GetOrLoad(ctx, testKey, 60, func() ([]byte, error) {
+			return nil, testErr
+		})
+		var le *LoadError
+		if !errors.As(err, &le) || !errors.Is(err, testErr) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("CacheError", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		rt := NewReadThrough(mc, ReadThroughOptions{})
+		mc.EXPECT().Get(gomock.Eq(testKey)).Return(nil, testErr)
+
+		_, err := rt.GetOrLoad(ctx, testKey, 60, func() ([]byte, error) {
+			t.Error("loader was called on cache error")
+			return nil, nil
+		})
+		var le *LoadError
+		if err != testErr || errors.As(err, &le) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ConcurrentMissesShareLoader", func(t *testing.T) {
+		const n = 10
+		mc := NewMockClient(gomock.NewController(t))
+		rt := NewReadThrough(mc, ReadThroughOptions{})
+		mc.EXPECT().Get(gomock.Eq(testKey)).Times(n).Return(nil, memcache.ErrCacheMiss)
+		mc.EXPECT().Set(gomock.Any()).Return(nil)
+
+		// the loader returns only when every caller has joined its flight
+		var joined sync.WaitGroup
+		joined.Add(n)
+		rt.group.joined = func(string) { joined.Done() }
+		var calls int32
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				v, err := rt.GetOrLoad(ctx, testKey, 60, func() ([]byte, error) {
+					atomic.AddInt32(&calls, 1)
+					joined.Wait()
+					return []byte("loaded"), nil
+				})
+				if err != nil || string(v) != "loaded" {
+					t.Errorf("unexpected result: %q, %v", v, err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if calls != 1 {
+			t.Errorf("loader was called %d times", calls)
+		}
+	})
+
+	t.Run("ContextCanceled", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		rt := NewReadThrough(mc, ReadThroughOptions{})
+		mc.EXPECT().Get(gomock.Eq(testKey)).Return(nil, memcache.ErrCacheMiss)
+
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		release := make(chan struct{})
+		defer close(release)
+		_, err := rt.GetOrLoad(ctx, testKey, 60, func() ([]byte, error) {
+			<-release
+			return nil, testErr
+		})
+		if err != context.Canceled {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestReadThroughEarly(t *testing.T) {
+	ctx := context.Background()
+	fc := newFakeClient()
+	r := 0.0
+	rt := NewReadThrough(fc, ReadThroughOptions{Rand: func() float64 { return r }})
+	now := time.Unix(1600000000, 0)
+	rt.now = func() time.Time { return now }
+
+	var loads int
+	loader := func() ([]byte, error) {
+		loads++
+		// the loader takes 10 seconds
+		now = now.Add(10 * time.Second)
+		return []byte("loaded"), nil
+	}
+
+	v, err := rt.GetOrLoadEarly(ctx, testKey, 60, loader)
+	if err != nil || string(v) != "loaded" || loads != 1 {
+		t.Fatalf("unexpected result on miss: %q, %v, %d", v, err, loads)
+	}
+
+	// 5 seconds before the expiry
+	now = now.Add(45 * time.Second)
+	v, err = rt.GetOrLoadEarly(ctx, testKey, 60, loader)
+	if err != nil || string(v) != "loaded" || loads != 1 {
+		t.Errorf("recomputed with low random number: %q, %v, %d", v, err, loads)
+	}
+
+	// -log(1-0.99) * 10s is about 46s, beyond the expiry
+	r = 0.99
+	v, err = rt.GetOrLoadEarly(ctx, testKey, 60, loader)
+	if err != nil || string(v) != "loaded" || loads != 2 {
+		t.Errorf("not recomputed with high random number: %q, %v, %d", v, err, loads)
+	}
+
+	r = 0.5
+	now = now.Add(100 * time.Second)
+	_, err = rt.GetOrLoadEarly(ctx, testKey, 60, func() ([]byte, error) {
+		return nil, testErr
+	})
+	if err != nil {
+		t.Errorf("failed early recomputation was not hidden: %v", err)
+	}
+}
+
+func TestReadThroughEarlyNoExpiry(t *testing.T) {
+	fc := newFakeClient()
+	rt := NewReadThrough(fc, ReadThroughOptions{Rand: func() float64 { return 0.99 }})
+	var loads int
+	for i := 0; i < 5; i++ {
+		v, err := rt.GetOrLoadEarly(context.Background(), testKey, 0, func() ([]byte, error) {
+			loads++
+			return []byte("loaded"), nil
+		})
+		if err != nil || string(v) != "loaded" {
+			t.Errorf("unexpected result: %q, %v", v, err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("loader was called %d times", loads)
+	}
+}
+
+func TestReadThroughLeased(t *testing.T) {
+	ctx := context.Background()
+	opts := ReadThroughOptions{LeaseTTL: time.Second, LeasePollInterval: 100 * time.Millisecond}
+
+	newLeased := func(fc *fakeClient, opts ReadThroughOptions, onPoll func(n int)) *ReadThrough {
+		rt := NewReadThrough(fc, opts)
+		now := time.Unix(1600000000, 0)
+		polls := 0
+		rt.now = func() time.Time { return now }
+		rt.after = func(d time.Duration) <-chan time.Time {
+			polls++
+			now = now.Add(d)
+			onPoll(polls)
+			ch := make(chan time.Time, 1)
+			ch <- now
+			return ch
+		}
+		return rt
+	}
+
+	t.Run("LeaseHolderLoads", func(t *testing.T) {
+		fc := newFakeClient()
+		rt := newLeased(fc, opts, func(int) { t.Error("lease holder polled") })
+
+		v, err := rt.GetOrLoadLeased(ctx, testKey, 60, func() ([]byte, error) {
+			if _, err := fc.Get(testKey + leaseKeySuffix); err != nil {
+				t.Errorf("lease was not held while loading: %v", err)
+			}
+			return []byte("loaded"), nil
+		})
+		if err != nil || string(v) != "loaded" {
+			t.Errorf("unexpected result: %q, %v", v, err)
+		}
+		if _, err := fc.Get(testKey + leaseKeySuffix); err != memcache.ErrCacheMiss {
+			t.Errorf("lease was not released: %v", err)
+		}
+	})
+
+	t.Run("ExpiredLeaseIsNotReleased", func(t *testing.T) {
+		fc := newFakeClient()
+		rt := newLeased(fc, opts, func(int) { t.Error("lease holder polled") })
+
+		other := &memcache.Item{Key: testKey + leaseKeySuffix, Value: []byte("other")}
+		if _, err := rt.GetOrLoadLeased(ctx, testKey, 60, func() ([]byte, error) {
+			// the lease expires and another process takes it
+			fc.Set(other)
+			return []byte("loaded"), nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if item, err := fc.Get(other.Key); err != nil || string(item.Value) != "other" {
+			t.Errorf("lease of another process was released: %v, %v", item, err)
+		}
+	})
+
+	t.Run("LeaseHolderRechecksValue", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		rt := NewReadThrough(mc, opts)
+		leaseKey := testKey + leaseKeySuffix
+		var token []byte
+		gomock.InOrder(
+			mc.EXPECT().Get(gomock.Eq(testKey)).Return(nil, memcache.ErrCacheMiss),
+			mc.EXPECT().Add(gomock.Any()).DoAndReturn(func(item *memcache.Item) error {
+				token = item.Value
+				return nil
+			}),
+			mc.EXPECT().Get(gomock.Eq(testKey)).Return(&memcache.Item{Key: testKey, Value: []byte("other")}, nil),
+			mc.EXPECT().Get(gomock.Eq(leaseKey)).DoAndReturn(func(key string) (*memcache.Item, error) {
+				return &memcache.Item{Key: key, Value: token}, nil
+			}),
+			mc.EXPECT().Delete(gomock.Eq(leaseKey)).Return(nil),
+		)
+
+		v, err := rt.GetOrLoadLeased(ctx, testKey, 60, func() ([]byte, error) {
+			t.Error("loader was called for a stored value")
+			return nil, nil
+		})
+		if err != nil || string(v) != "other" {
+			t.Errorf("unexpected result: %q, %v", v, err)
+		}
+	})
+
+	t.Run("WaiterPolls", func(t *testing.T) {
+		fc := newFakeClient()
+		fc.Add(&memcache.Item{Key: testKey + leaseKeySuffix})
+		rt := newLeased(fc, opts, func(n int) {
+			if n == 3 {
+				fc.Set(&memcache.Item{Key: testKey, Value: []byte("other")})
+			}
+		})
+
+		v, err := rt.GetOrLoadLeased(ctx, testKey, 60, func() ([]byte, error) {
+			t.Error("waiter called loader")
+			return nil, nil
+		})
+		if err != nil || string(v) != "other" {
+			t.Errorf("unexpected result: %q, %v", v, err)
+		}
+	})
+
+	t.Run("WaiterTimesOut", func(t *testing.T) {
+		fc := newFakeClient()
+		fc.Add(&memcache.Item{Key: testKey + leaseKeySuffix})
+		var polls int
+		rt := newLeased(fc, opts, func(n int) { polls = n })
+
+		_, err := rt.GetOrLoadLeased(ctx, testKey, 60, func() ([]byte, error) {
+			t.Error("waiter called loader")
+			return nil, nil
+		})
+		if err != ErrLeaseTimeout || polls != 10 {
+			t.Errorf("unexpected result: %v after %d polls", err, polls)
+		}
+	})
+
+	t.Run("WaiterCancelDoesNotAffectOthers", func(t *testing.T) {
+		fc := newFakeClient()
+		fc.Add(&memcache.Item{Key: testKey + leaseKeySuffix})
+		rt := NewReadThrough(fc, opts)
+		polling := make(chan struct{}, 1)
+		tick := make(chan time.Time)
+		rt.after = func(time.Duration) <-chan time.Time {
+			select {
+			case polling <- struct{}{}:
+			default:
+			}
+			return tick
+		}
+		loader := func() ([]byte, error) {
+			t.Error("waiter called loader")
+			return nil, nil
+		}
+
+		joined := make(chan struct{}, 2)
+		rt.group.joined = func(string) { joined <- struct{}{} }
+
+		ctxA, cancel := context.WithCancel(ctx)
+		errA := make(chan error, 1)
+		go func() {
+			_, err := rt.GetOrLoadLeased(ctxA, testKey, 60, loader)
+			errA <- err
+		}()
+		<-polling
+		resultB := make(chan string, 1)
+		go func() {
+			v, err := rt.GetOrLoadLeased(ctx, testKey, 60, loader)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			resultB <- string(v)
+		}()
+		<-joined
+		<-joined
+
+		cancel()
+		if err := <-errA; err != context.Canceled {
+			t.Errorf("unexpected error: %v", err)
+		}
+		fc.Set(&memcache.Item{Key: testKey, Value: []byte("other")})
+		select {
+		case tick <- time.Now():
+		case <-time.After(time.Second):
+		}
+		if v := <-resultB; v != "other" {
+			t.Errorf("unexpected result: %q", v)
+		}
+	})
+
+	t.Run("WaiterGetsStale", func(t *testing.T) {
+		fc := newFakeClient()
+		staleOpts := opts
+		staleOpts.StaleTTL = time.Hour
+		rt := newLeased(fc, staleOpts, func(int) { t.Error("polled with stale value") })
+
+		if _, err := rt.GetOrLoadLeased(ctx, testKey, 60, func() ([]byte, error) {
+			return []byte("old"), nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		fc.Delete(testKey)
+		fc.Add(&memcache.Item{Key: testKey + leaseKeySuffix})
+
+		v, err := rt.GetOrLoadLeased(ctx, testKey, 60, func() ([]byte, error) {
+			t.Error("waiter called loader")
+			return nil, nil
+		})
+		if err != nil || string(v) != "old" {
+			t.Errorf("unexpected result: %q, %v", v, err)
+		}
+	})
+}
+
+func TestReadThroughNegative(t *testing.T) {
+	ctx := context.Background()
+	fc := newFakeClient()
+	rt := NewReadThrough(fc, ReadThroughOptions{NegativeTTL: time.Minute})
+
+	var loads int
+	loaderErr := fmt.Errorf("no user: %w", ErrNotFound)
+	loader := func() ([]byte, error) {
+		loads++
+		return nil, loaderErr
+	}
+
+	_, err := rt.GetOrLoad(ctx, testKey, 60, loader)
+	var nf *NotFoundError
+	if !errors.As(err, &nf) || nf.Cached || !errors.Is(err, loaderErr) {
+		t.Errorf("unexpected error on first read: %v", err)
+	}
+
+	_, err = rt.GetOrLoad(ctx, testKey, 60, loader)
+	if !errors.As(err, &nf) || !nf.Cached {
+		t.Errorf("unexpected error on second read: %v", err)
+	}
+	if loads != 1 {
+		t.Errorf("loader was called %d times", loads)
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		fc := newFakeClient()
+		rt := NewReadThrough(fc, ReadThroughOptions{})
+		rt.GetOrLoad(ctx, testKey, 60, loader)
+		if _, err := fc.Get(testKey); err != memcache.ErrCacheMiss {
+			t.Errorf("tombstone was stored: %v", err)
+		}
+	})
+
+	t.Run("Early", func(t *testing.T) {
+		fc := newFakeClient()
+		rt := NewReadThrough(fc, ReadThroughOptions{NegativeTTL: time.Minute})
+		_, err := rt.GetOrLoadEarly(ctx, testKey, 60, loader)
+		var nf *NotFoundError
+		if !errors.As(err, &nf) || !errors.Is(err, loaderErr) {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if _, err := fc.Get(testKey); err != memcache.ErrCacheMiss {
+			t.Errorf("tombstone was stored: %v", err)
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package memcacheex
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// Freshness tells whether a value returned by RevalidatingCache was fresh,
+// stale or loaded because of a cache miss.
+type Freshness int
+
+const (
+	Fresh Freshness = iota
+	Stale
+	Missed
+)
+
+func (f Freshness) String() string {
+	switch f {
+	case Fresh:
+		return "fresh"
+	case Stale:
+		return "stale"
+	case Missed:
+		return "missed"
+	}
+	return "unknown"
+}
+
+type RevalidateOptions struct {
+	// SoftTTL is how long a value is fresh.
+	SoftTTL time.Duration
+	// HardTTL is the expiration of the item in memcached. It should be
+	// longer than SoftTTL, otherwise values are never served stale.
+	HardTTL time.Duration
+}
+
+// RevalidatingCache serves stale values while refreshing them in the
+// background. Only one refresh per key runs at a time in this process.
+type RevalidatingCache struct {
+	client   Client
+	opts     RevalidateOptions
+	group    flightGroup
+	callback *callbacks
+	now      func() time.Time
+}
+
+func NewRevalidatingCache(client Client, opts RevalidateOptions) *RevalidatingCache {
+	return &RevalidatingCache{
+		client:   client,
+		opts:     opts,
+		callback: &callbacks{},
+		now:      time.Now,
+	}
+}
+
+// Callback returns the callbacks invoked by Get. Handlers receive
+// args []any{key} and results []any{value, Freshness, err}.
+func (rc *RevalidatingCache) Callback() *callbacks {
+	return rc.callback
+}
+
+// Get gets the value for the given key. A fresh value is returned as is.
+// A stale value is returned immediately and refreshed with loader in the
+// background. On a miss, or if the stored value is not an envelope, the
+// loader is called synchronously.
+func (rc *RevalidatingCache) Get(ctx context.Context, key string, loader func() ([]byte, error)) ([]byte, Freshness, error) {
+	for _, cb := range rc.callback.befores {
+		cb.fn([]any{key}, nil)
+	}
+	value, freshness, err := rc.get(ctx, key, loader)
+	for _, cb := range rc.callback.afters {
+		cb.fn([]any{key}, []any{value, freshness, err})
+	}
+	return value, freshness, err
+}
+
+func (rc *RevalidatingCache) get(ctx context.Context, key string, loader func() ([]byte, error)) ([]byte, Freshness, error) {
+	item, err := rc.client.Get(key)
+	if err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+		return nil, Missed, err
+	}
+	var e envelope
+	if err == nil && e.unmarshal(item.Value) == nil {
+		if rc.now().Before(e.softExpiry) {
+			return e.value, Fresh, nil
+		}
+		rc.group.start(key, func() ([]byte, error) {
+			return rc.load(key, loader)
+		})
+		return e.value, Stale, nil
+	}
+	value, err := rc.group.do(ctx, key, func() ([]byte, error) {
+		return rc.load(key, loader)
+	})
+	return value, Missed, err
+}
+
+// Set stores value for the given key with fresh soft and hard expiries.
+func (rc *RevalidatingCache) Set(key string, value []byte) error {
+	e := envelope{softExpiry: rc.now().Add(rc.opts.SoftTTL), value: value}
+	return rc.client.Set(&memcache.Item{
+		Key:        key,
+		Value:      e.marshal(),
+		Expiration: seconds(rc.opts.HardTTL),
+	})
+}
+
+func (rc *RevalidatingCache) load(key string, loader func() ([]byte, error)) ([]byte, error) {
+	value, err := loader()
+	if err != nil {
+		return nil, loadError(key, err)
+	}
+	return value, rc.Set(key, value)
+}
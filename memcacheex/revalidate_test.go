@@ -0,0 +1,70 @@
+package memcacheex
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRevalidatingCache(t *testing.T) {
+	ctx := context.Background()
+	fc := newFakeClient()
+	rc := NewRevalidatingCache(fc, RevalidateOptions{SoftTTL: time.Minute, HardTTL: time.Hour})
+	now := time.Unix(1600000000, 0)
+	rc.now = func() time.Time { return now }
+
+	var seen []Freshness
+	rc.Callback().After().Register("test", func(args, results []any) {
+		seen = append(seen, results[1].(Freshness))
+	})
+
+	var loads int32
+	refreshed := make(chan struct{}, 1)
+	loader := func() ([]byte, error) {
+		n := atomic.AddInt32(&loads, 1)
+		refreshed <- struct{}{}
+		return []byte{byte('0' + n)}, nil
+	}
+
+	v, f, err := rc.Get(ctx, testKey, loader)
+	<-refreshed
+	if err != nil || f != Missed || string(v) != "1" {
+		t.Errorf("unexpected result on miss: %q, %v, %v", v, f, err)
+	}
+
+	v, f, err = rc.Get(ctx, testKey, loader)
+	if err != nil || f != Fresh || string(v) != "1" {
+		t.Errorf("unexpected result on fresh: %q, %v, %v", v, f, err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	v, f, err = rc.Get(ctx, testKey, loader)
+	if err != nil || f != Stale || string(v) != "1" {
+		t.Errorf("unexpected result on stale: %q, %v, %v", v, f, err)
+	}
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("background refresh was not triggered")
+	}
+	// wait for the refresh to be stored
+	for i := 0; i < 100 && fc.called("Set") < 2; i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	v, f, err = rc.Get(ctx, testKey, loader)
+	if err != nil || f != Fresh || string(v) != "2" {
+		t.Errorf("unexpected result after refresh: %q, %v, %v", v, f, err)
+	}
+
+	want := []Freshness{Missed, Fresh, Stale, Fresh}
+	if len(seen) != len(want) {
+		t.Fatalf("unexpected callbacks: %v", seen)
+	}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Errorf("unexpected callbacks: %v", seen)
+		}
+	}
+}
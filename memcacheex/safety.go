@@ -0,0 +1,73 @@
+package memcacheex
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// ErrBlockedBySafetyPolicy is returned when a destructive method is refused
+// by the SafetyPolicy of a ClientWrapper.
+var ErrBlockedBySafetyPolicy = errors.New("memcacheex: blocked by safety policy")
+
+// SafetyPolicy guards destructive methods (FlushAll and DeleteAll), which a
+// ClientWrapper blocks unless a policy allows them. A method is only allowed
+// when Allow is true and, if ConfirmToken or AllowEnv is configured, either
+// the confirmation token matches ConfirmToken or the environment variable
+// named AllowEnv is set to a non-empty value.
+type SafetyPolicy struct {
+	Allow        bool
+	ConfirmToken string
+	AllowEnv     string
+	// Audit is called for every attempt, whether it is allowed or not.
+	Audit func(AuditEvent)
+}
+
+type AuditEvent struct {
+	Method  string
+	Allowed bool
+	Time    time.Time
+}
+
+func (p *SafetyPolicy) check(method, token string) error {
+	confirmed := p.ConfirmToken == "" && p.AllowEnv == "" ||
+		p.ConfirmToken != "" && token == p.ConfirmToken ||
+		p.AllowEnv != "" && os.Getenv(p.AllowEnv) != ""
+	allowed := p.Allow && confirmed
+	if p.Audit != nil {
+		p.Audit(AuditEvent{Method: method, Allowed: allowed, Time: time.Now()})
+	}
+	if !allowed {
+		return ErrBlockedBySafetyPolicy
+	}
+	return nil
+}
+
+// SetSafetyPolicy installs a policy guarding FlushAll and DeleteAll.
+// A nil policy blocks them, which is the default.
+func (cw *ClientWrapper) SetSafetyPolicy(p *SafetyPolicy) {
+	cw.safety = p
+}
+
+func (cw *ClientWrapper) checkSafety(method, token string) error {
+	if cw.safety == nil {
+		return ErrBlockedBySafetyPolicy
+	}
+	return cw.safety.check(method, token)
+}
+
+// FlushAllConfirmed is FlushAll with a confirmation token for the SafetyPolicy.
+func (cw *ClientWrapper) FlushAllConfirmed(token string) error {
+	if err := cw.checkSafety("FlushAll", token); err != nil {
+		return err
+	}
+	return cw.flushAll()
+}
+
+// DeleteAllConfirmed is DeleteAll with a confirmation token for the SafetyPolicy.
+func (cw *ClientWrapper) DeleteAllConfirmed(token string) error {
+	if err := cw.checkSafety("DeleteAll", token); err != nil {
+		return err
+	}
+	return cw.deleteAll()
+}
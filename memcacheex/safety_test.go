@@ -0,0 +1,111 @@
+package memcacheex
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+)
+
+func TestSafetyPolicy(t *testing.T) {
+	const token = "yes-really"
+	const env = "GOMEMCACHEEX_TEST_ALLOW_FLUSH"
+
+	t.Run("BlockedByDefault", func(t *testing.T) {
+		// no expectations: any call to the underlying client fails the test
+		mc := NewMockClient(gomock.NewController(t))
+		cw := NewClientWrapper(mc)
+
+		if err := cw.FlushAll(); err != ErrBlockedBySafetyPolicy {
+			t.Errorf("FlushAll was not blocked: %v", err)
+		}
+		if err := cw.DeleteAll(); err != ErrBlockedBySafetyPolicy {
+			t.Errorf("DeleteAll was not blocked: %v", err)
+		}
+	})
+
+	t.Run("BlockedWhenNotAllowedByPolicy", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		cw := NewClientWrapper(mc)
+		var events []AuditEvent
+		cw.SetSafetyPolicy(&SafetyPolicy{Audit: func(e AuditEvent) { events = append(events, e) }})
+
+		if err := cw.FlushAll(); err != ErrBlockedBySafetyPolicy {
+			t.Errorf("FlushAll was not blocked: %v", err)
+		}
+		if err := cw.DeleteAll(); err != ErrBlockedBySafetyPolicy {
+			t.Errorf("DeleteAll was not blocked: %v", err)
+		}
+		if len(events) != 2 || events[0].Method != "FlushAll" || events[0].Allowed || events[1].Method != "DeleteAll" {
+			t.Errorf("unexpected audit events: %+v", events)
+		}
+	})
+
+	t.Run("BlockedWithWrongToken", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		cw := NewClientWrapper(mc)
+		cw.SetSafetyPolicy(&SafetyPolicy{Allow: true, ConfirmToken: token})
+
+		if err := cw.FlushAll(); err != ErrBlockedBySafetyPolicy {
+			t.Errorf("FlushAll was not blocked: %v", err)
+		}
+		if err := cw.FlushAllConfirmed("nope"); err != ErrBlockedBySafetyPolicy {
+			t.Errorf("FlushAllConfirmed was not blocked: %v", err)
+		}
+	})
+
+	t.Run("BlockedWhenNotAllowed", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		cw := NewClientWrapper(mc)
+		cw.SetSafetyPolicy(&SafetyPolicy{ConfirmToken: token})
+
+		if err := cw.DeleteAllConfirmed(token); err != ErrBlockedBySafetyPolicy {
+			t.Errorf("DeleteAllConfirmed was not blocked: %v", err)
+		}
+	})
+
+	t.Run("Allowed", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		cw := NewClientWrapper(mc)
+		cw.SetSafetyPolicy(&SafetyPolicy{Allow: true})
+		mc.EXPECT().FlushAll().Return(nil)
+
+		if err := cw.FlushAll(); err != nil {
+			t.Errorf("FlushAll was blocked: %v", err)
+		}
+	})
+
+	t.Run("AllowedWithToken", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		cw := NewClientWrapper(mc)
+		var events []AuditEvent
+		cw.SetSafetyPolicy(&SafetyPolicy{Allow: true, ConfirmToken: token, Audit: func(e AuditEvent) { events = append(events, e) }})
+		mc.EXPECT().FlushAll().Return(nil)
+		mc.EXPECT().DeleteAll().Return(nil)
+
+		if err := cw.FlushAllConfirmed(token); err != nil {
+			t.Errorf("FlushAllConfirmed was blocked: %v", err)
+		}
+		if err := cw.DeleteAllConfirmed(token); err != nil {
+			t.Errorf("DeleteAllConfirmed was blocked: %v", err)
+		}
+		if len(events) != 2 || !events[0].Allowed || !events[1].Allowed {
+			t.Errorf("unexpected audit events: %+v", events)
+		}
+	})
+
+	t.Run("AllowedWithEnv", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		cw := NewClientWrapper(mc)
+		cw.SetSafetyPolicy(&SafetyPolicy{Allow: true, AllowEnv: env})
+
+		if err := cw.FlushAll(); err != ErrBlockedBySafetyPolicy {
+			t.Errorf("FlushAll was not blocked: %v", err)
+		}
+
+		t.Setenv(env, "1")
+		mc.EXPECT().FlushAll().Return(nil)
+		if err := cw.FlushAll(); err != nil {
+			t.Errorf("FlushAll was blocked: %v", err)
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package memcacheex
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// schemaFlagShift is the position of the schema version in Item.Flags,
+// which takes the upper 16 bits.
+const schemaFlagShift = 16
+
+var (
+	// ErrSchemaTooNew is returned by GetAs for values written with a newer
+	// schema version than the registered one.
+	ErrSchemaTooNew = errors.New("memcacheex: schema version too new")
+	// ErrNoUpgrade is returned by GetAs when no upgrade is registered for
+	// the schema version of a value.
+	ErrNoUpgrade = errors.New("memcacheex: no schema upgrade")
+)
+
+// Upgrade upgrades a value from one schema version to the next. decode
+// decodes the value of the old version into v, and the returned value is
+// encoded as the value of the next version.
+type Upgrade func(decode func(v any) error) (any, error)
+
+type Schema struct {
+	// Version is the current schema version, from 1 to 65535. Values
+	// written without a schema have version 0.
+	Version uint32
+	// Upgrades holds the upgrade from each older version to the next.
+	Upgrades map[uint32]Upgrade
+	// Rewrite writes upgraded values back with CompareAndSwap, so that
+	// they are upgraded only once.
+	Rewrite bool
+	// RewriteTTL is the expiration of rewritten values. Memcached does not
+	// return the expiration of the value read, so it cannot be kept. Zero
+	// means no expiration.
+	RewriteTTL int32
+	// OnRewriteError, if set, is called when a rewrite fails. The upgraded
+	// value is still returned. ErrCASConflict and ErrNotStored mean that
+	// the value was changed or evicted since it was read.
+	OnRewriteError func(key string, err error)
+}
+
+var (
+	schemasMu sync.RWMutex
+	schemas   = make(map[reflect.Type]Schema)
+)
+
+// RegisterSchema registers the schema of T. SetAs records its version in
+// the upper 16 bits of Item.Flags, and GetAs upgrades older values.
+func RegisterSchema[T any](s Schema) {
+	if s.Version == 0 || s.Version > 0xffff {
+		panic(fmt.Sprintf("memcacheex: schema version %d out of range", s.Version))
+	}
+	schemasMu.Lock()
+	defer schemasMu.Unlock()
+	schemas[typeOf[T]()] = s
+}
+
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+func schemaFor(t reflect.Type) (Schema, bool) {
+	schemasMu.RLock()
+	defer schemasMu.RUnlock()
+	s, ok := schemas[t]
+	return s, ok
+}
+
+// upgradeItem upgrades the value of item to the current version of s.
+// It reports whether the value was upgraded.
+func upgradeItem(codec Codec, s Schema, item *memcache.Item) (bool, error) {
+	version := item.Flags >> schemaFlagShift
+	if version > s.Version {
+		return false, fmt.Errorf("%w: %d > %d", ErrSchemaTooNew, version, s.Version)
+	}
+	if version == s.Version {
+		return false, nil
+	}
+	data := item.Value
+	for ; version < s.Version; version++ {
+		upgrade, ok := s.Upgrades[version]
+		if !ok {
+			return false, fmt.Errorf("%w: from version %d", ErrNoUpgrade, version)
+		}
+		old := data
+		v, err := upgrade(func(v any) error {
+			return codec.Unmarshal(old, v)
+		})
+		if err != nil {
+			return false, err
+		}
+		if data, err = codec.Marshal(v); err != nil {
+			return false, err
+		}
+	}
+	item.Value = data
+	item.Flags = item.Flags&(1<<schemaFlagShift-1) | s.Version<<schemaFlagShift
+	return true, nil
+}
@@ -0,0 +1,121 @@
+package memcacheex
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/golang/mock/gomock"
+)
+
+type testProfileV0 struct {
+	Name string
+}
+
+type testProfileV1 struct {
+	First string
+	Last  string
+}
+
+type testProfile struct {
+	First string
+	Last  string
+	Admin bool
+}
+
+func TestSchema(t *testing.T) {
+	RegisterSchema[testProfile](Schema{
+		Version: 2,
+		Upgrades: map[uint32]Upgrade{
+			0: func(decode func(v any) error) (any, error) {
+				var old testProfileV0
+				if err := decode(&old); err != nil {
+					return nil, err
+				}
+				first, last, _ := strings.Cut(old.Name, " ")
+				return testProfileV1{First: first, Last: last}, nil
+			},
+			1: func(decode func(v any) error) (any, error) {
+				var old testProfileV1
+				if err := decode(&old); err != nil {
+					return nil, err
+				}
+				return testProfile{First: old.First, Last: old.Last}, nil
+			},
+		},
+		Rewrite:    true,
+		RewriteTTL: 60,
+	})
+	want := testProfile{First: "Rob", Last: "Pike"}
+
+	for _, codec := range []Codec{JSONCodec, GobCodec} {
+		fc := newFakeClient()
+		if err := SetAsWith(fc, codec, testKey, testProfileV0{Name: "Rob Pike"}, 60); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := GetAs[testProfile](fc, testKey)
+		if err != nil || got != want {
+			t.Errorf("unexpected result with codec %d: %+v, %v", codec.ID(), got, err)
+		}
+		stored, _ := fc.Get(testKey)
+		if stored.Flags != 2<<schemaFlagShift|codec.ID() {
+			t.Errorf("upgraded value was not rewritten: %x", stored.Flags)
+		}
+		if exp := fc.expiration(testKey); exp != 60 {
+			t.Errorf("rewritten value has expiration %d", exp)
+		}
+		if got, err := GetAs[testProfile](fc, testKey); err != nil || got != want {
+			t.Errorf("unexpected result after rewrite: %+v, %v", got, err)
+		}
+	}
+
+	t.Run("SetAsRecordsVersion", func(t *testing.T) {
+		fc := newFakeClient()
+		SetAs(fc, testKey, want, 0)
+		if stored, _ := fc.Get(testKey); stored.Flags>>schemaFlagShift != 2 {
+			t.Errorf("version was not recorded: %x", stored.Flags)
+		}
+	})
+
+	t.Run("TooNew", func(t *testing.T) {
+		fc := newFakeClient()
+		fc.Set(&memcache.Item{Key: testKey, Value: []byte("{}"), Flags: 3<<schemaFlagShift | JSONCodec.ID()})
+		if _, err := GetAs[testProfile](fc, testKey); !errors.Is(err, ErrSchemaTooNew) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("NoUpgrade", func(t *testing.T) {
+		RegisterSchema[testProfileV1](Schema{Version: 1})
+		fc := newFakeClient()
+		SetAsWith(fc, JSONCodec, testKey, testProfileV0{}, 0)
+		if _, err := GetAs[testProfileV1](fc, testKey); !errors.Is(err, ErrNoUpgrade) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("RewriteError", func(t *testing.T) {
+		var rewriteErr error
+		RegisterSchema[testProfileV1](Schema{
+			Version: 1,
+			Upgrades: map[uint32]Upgrade{
+				0: func(decode func(v any) error) (any, error) {
+					return testProfileV1{First: "Rob"}, nil
+				},
+			},
+			Rewrite:        true,
+			OnRewriteError: func(key string, err error) { rewriteErr = err },
+		})
+		mc := NewMockClient(gomock.NewController(t))
+		mc.EXPECT().Get(gomock.Eq(testKey)).Return(&memcache.Item{Key: testKey, Value: []byte("{}"), Flags: JSONCodec.ID()}, nil)
+		mc.EXPECT().CompareAndSwap(gomock.Any()).Return(memcache.ErrCASConflict)
+		if got, err := GetAs[testProfileV1](mc, testKey); err != nil || got.First != "Rob" {
+			t.Errorf("unexpected result: %+v, %v", got, err)
+		}
+		if rewriteErr != memcache.ErrCASConflict {
+			t.Errorf("rewrite error was not reported: %v", rewriteErr)
+		}
+	})
+}
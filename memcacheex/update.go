@@ -0,0 +1,123 @@
+package memcacheex
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// ErrTooManyAttempts is returned by Update when the item could not be
+// stored within MaxAttempts.
+var ErrTooManyAttempts = errors.New("memcacheex: too many attempts")
+
+type UpdateOptions struct {
+	// MaxAttempts is the maximum number of read-modify-write attempts.
+	// Defaults to 10.
+	MaxAttempts int
+	// Backoff is the wait before the second attempt, doubled for each
+	// further attempt up to MaxBackoff. Defaults to 1ms.
+	Backoff time.Duration
+	// MaxBackoff defaults to 100ms.
+	MaxBackoff time.Duration
+}
+
+// Update atomically modifies the item for the given key. fn receives the
+// current item, or nil if there is none, and returns the item to store.
+// Only Value, Flags and Expiration of the returned item are used.
+//
+// Memcached does not return expirations, so Expiration of the item passed
+// to fn is always 0, and fn must set it on the returned item to keep a TTL.
+//
+// If fn returns a nil item, nothing is stored and Update returns the current
+// item, or ErrCacheMiss if there is none. Errors of fn are returned as is.
+//
+// Existing items are stored with CompareAndSwap and new ones with Add. fn is
+// called again when another writer got in between, that is when the item was
+// changed, deleted or added concurrently.
+func Update(
+	c Client,
+	key string,
+	fn func(old *memcache.Item) (*memcache.Item, error),
+	opts UpdateOptions,
+) (*memcache.Item, error) {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 10
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 100 * time.Millisecond
+	}
+
+	backoff := opts.Backoff
+	var err error
+	for attempt := 0; attempt < opts.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > opts.MaxBackoff {
+				backoff = opts.MaxBackoff
+			}
+		}
+
+		var item *memcache.Item
+		var raced bool
+		if item, raced, err = updateOnce(c, key, fn); err == nil {
+			return item, nil
+		}
+		if !raced {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("%w: %v", ErrTooManyAttempts, err)
+}
+
+func updateOnce(
+	c Client,
+	key string,
+	fn func(old *memcache.Item) (*memcache.Item, error),
+) (item *memcache.Item, raced bool, err error) {
+	old, err := c.Get(key)
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		old = nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	var arg *memcache.Item
+	if old != nil {
+		// fn may modify its argument, so keep old for the cas id
+		o := *old
+		arg = &o
+	}
+	updated, err := fn(arg)
+	if err != nil {
+		return nil, false, err
+	}
+	if updated == nil {
+		if old == nil {
+			return nil, false, memcache.ErrCacheMiss
+		}
+		return old, false, nil
+	}
+
+	item = &memcache.Item{Key: key}
+	if old != nil {
+		// a copy of old keeps the cas id from Get
+		o := *old
+		item = &o
+	}
+	item.Value = updated.Value
+	item.Flags = updated.Flags
+	item.Expiration = updated.Expiration
+	if old == nil {
+		err = c.Add(item)
+		return item, errors.Is(err, memcache.ErrNotStored), err
+	}
+	// CompareAndSwap fails with ErrCacheMiss if the item was deleted
+	err = c.CompareAndSwap(item)
+	raced = errors.Is(err, memcache.ErrCASConflict) || errors.Is(err, memcache.ErrCacheMiss)
+	return item, raced, err
+}
@@ -0,0 +1,103 @@
+package memcacheex
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/golang/mock/gomock"
+)
+
+func TestUpdate(t *testing.T) {
+	incr := func(old *memcache.Item) (*memcache.Item, error) {
+		if old == nil {
+			return &memcache.Item{Value: []byte("1")}, nil
+		}
+		n, err := strconv.Atoi(string(old.Value))
+		if err != nil {
+			return nil, err
+		}
+		return &memcache.Item{Value: []byte(strconv.Itoa(n + 1))}, nil
+	}
+
+	t.Run("Concurrent", func(t *testing.T) {
+		fc := newFakeClient()
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := Update(fc, testKey, incr, UpdateOptions{MaxAttempts: 100}); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+		if item, _ := fc.Get(testKey); string(item.Value) != "20" {
+			t.Errorf("unexpected value: %q", item.Value)
+		}
+	})
+
+	t.Run("FnError", func(t *testing.T) {
+		fc := newFakeClient()
+		fc.Set(&memcache.Item{Key: testKey, Value: []byte("x")})
+		if _, err := Update(fc, testKey, func(old *memcache.Item) (*memcache.Item, error) {
+			return nil, testErr
+		}, UpdateOptions{}); err != testErr {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if n := fc.called("CompareAndSwap"); n != 0 {
+			t.Errorf("CompareAndSwap was called %d times", n)
+		}
+	})
+
+	t.Run("NoChange", func(t *testing.T) {
+		fc := newFakeClient()
+		unchanged := func(old *memcache.Item) (*memcache.Item, error) {
+			return nil, nil
+		}
+		if _, err := Update(fc, testKey, unchanged, UpdateOptions{}); err != memcache.ErrCacheMiss {
+			t.Errorf("unexpected error: %v", err)
+		}
+		fc.Set(&memcache.Item{Key: testKey, Value: []byte("x")})
+		if item, err := Update(fc, testKey, unchanged, UpdateOptions{}); err != nil || string(item.Value) != "x" {
+			t.Errorf("unexpected result: %v, %v", item, err)
+		}
+		if n := fc.called("Add") + fc.called("CompareAndSwap"); n != 0 {
+			t.Errorf("item was stored %d times", n)
+		}
+	})
+
+	t.Run("EvictedBetween", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		gomock.InOrder(
+			mc.EXPECT().Get(gomock.Eq(testKey)).Return(&memcache.Item{Key: testKey, Value: []byte("1")}, nil),
+			mc.EXPECT().CompareAndSwap(gomock.Any()).Return(memcache.ErrCacheMiss),
+			mc.EXPECT().Get(gomock.Eq(testKey)).Return(nil, memcache.ErrCacheMiss),
+			mc.EXPECT().Add(gomock.Eq(&memcache.Item{Key: testKey, Value: []byte("1")})).Return(nil),
+		)
+		item, err := Update(mc, testKey, incr, UpdateOptions{})
+		if err != nil || string(item.Value) != "1" {
+			t.Errorf("unexpected result: %v, %v", item, err)
+		}
+	})
+
+	t.Run("TooManyAttempts", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		mc.EXPECT().Get(gomock.Eq(testKey)).Return(&memcache.Item{Key: testKey, Value: []byte("1")}, nil).Times(3)
+		mc.EXPECT().CompareAndSwap(gomock.Any()).Return(memcache.ErrCASConflict).Times(3)
+		if _, err := Update(mc, testKey, incr, UpdateOptions{MaxAttempts: 3}); !errors.Is(err, ErrTooManyAttempts) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("CacheError", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		mc.EXPECT().Get(gomock.Eq(testKey)).Return(nil, testErr)
+		if _, err := Update(mc, testKey, incr, UpdateOptions{}); err != testErr {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,202 @@
+package memcacheex
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+var _ Client = (*ValidatingClient)(nil)
+
+// ValidationError is returned by ValidatingClient before a request is sent.
+type ValidationError struct {
+	Method string
+	Key    string
+	// Field is one of "Key", "Value", "Expiration" or "CAS".
+	Field  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("memcacheex: %s %q: invalid %s: %s", e.Method, e.Key, e.Field, e.Reason)
+}
+
+// relativeExpirationLimit is the largest expiration that memcached treats
+// as relative seconds, larger ones are Unix timestamps.
+const relativeExpirationLimit = 60 * 60 * 24 * 30
+
+type ValidationOptions struct {
+	// MaxItemSize is the item size limit of the server. Defaults to 1MB.
+	MaxItemSize int
+	// WarnOnly reports violations to OnViolation but still sends requests.
+	WarnOnly bool
+	// OnViolation, if set, is called for every violation.
+	OnViolation func(err *ValidationError)
+}
+
+// ValidatingClient validates keys and items before they are sent to the
+// underlying client.
+type ValidatingClient struct {
+	Client
+	opts ValidationOptions
+	now  func() time.Time
+}
+
+func NewValidatingClient(client Client, opts ValidationOptions) *ValidatingClient {
+	if opts.MaxItemSize == 0 {
+		opts.MaxItemSize = 1024 * 1024
+	}
+	return &ValidatingClient{Client: client, opts: opts, now: time.Now}
+}
+
+func (vc *ValidatingClient) Get(key string) (*memcache.Item, error) {
+	if err := vc.check("Get", key, nil); err != nil {
+		return nil, err
+	}
+	return vc.Client.Get(key)
+}
+
+func (vc *ValidatingClient) Touch(key string, seconds int32) error {
+	if err := vc.check("Touch", key, nil); err != nil {
+		return err
+	}
+	if err := vc.report(vc.validateExpiration("Touch", key, seconds)); err != nil {
+		return err
+	}
+	return vc.Client.Touch(key, seconds)
+}
+
+func (vc *ValidatingClient) GetMulti(keys []string) (map[string]*memcache.Item, error) {
+	for _, key := range keys {
+		if err := vc.check("GetMulti", key, nil); err != nil {
+			return nil, err
+		}
+	}
+	return vc.Client.GetMulti(keys)
+}
+
+func (vc *ValidatingClient) Set(item *memcache.Item) error {
+	if err := vc.check("Set", item.Key, item); err != nil {
+		return err
+	}
+	return vc.Client.Set(item)
+}
+
+func (vc *ValidatingClient) Add(item *memcache.Item) error {
+	if err := vc.check("Add", item.Key, item); err != nil {
+		return err
+	}
+	return vc.Client.Add(item)
+}
+
+func (vc *ValidatingClient) Replace(item *memcache.Item) error {
+	if err := vc.check("Replace", item.Key, item); err != nil {
+		return err
+	}
+	return vc.Client.Replace(item)
+}
+
+func (vc *ValidatingClient) CompareAndSwap(item *memcache.Item) error {
+	if err := vc.check("CompareAndSwap", item.Key, item); err != nil {
+		return err
+	}
+	if id, ok := uintField(reflect.ValueOf(item).Elem(), "casid"); ok && id == 0 {
+		err := &ValidationError{"CompareAndSwap", item.Key, "CAS", "item was not obtained via Get"}
+		if err := vc.report(err); err != nil {
+			return err
+		}
+	}
+	return vc.Client.CompareAndSwap(item)
+}
+
+func (vc *ValidatingClient) Delete(key string) error {
+	if err := vc.check("Delete", key, nil); err != nil {
+		return err
+	}
+	return vc.Client.Delete(key)
+}
+
+func (vc *ValidatingClient) Increment(key string, delta uint64) (uint64, error) {
+	if err := vc.check("Increment", key, nil); err != nil {
+		return 0, err
+	}
+	return vc.Client.Increment(key, delta)
+}
+
+func (vc *ValidatingClient) Decrement(key string, delta uint64) (uint64, error) {
+	if err := vc.check("Decrement", key, nil); err != nil {
+		return 0, err
+	}
+	return vc.Client.Decrement(key, delta)
+}
+
+// uintField reads the unsigned integer field of v with the given name, which
+// may be unexported. It is used for the cas id of memcache.Item, and reports
+// false if a gomemcache release renames or retypes the field, in which case
+// the check is skipped.
+func uintField(v reflect.Value, name string) (uint64, bool) {
+	f := v.FieldByName(name)
+	switch f.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return f.Uint(), true
+	}
+	return 0, false
+}
+
+// check validates key and, if not nil, item. It returns the first violation
+// unless WarnOnly is set.
+func (vc *ValidatingClient) check(method, key string, item *memcache.Item) error {
+	if err := vc.report(validateKey(method, key)); err != nil {
+		return err
+	}
+	if item == nil {
+		return nil
+	}
+	if size := len(item.Key) + len(item.Value); size > vc.opts.MaxItemSize {
+		reason := fmt.Sprintf("item size %d exceeds %d", size, vc.opts.MaxItemSize)
+		if err := vc.report(&ValidationError{method, key, "Value", reason}); err != nil {
+			return err
+		}
+	}
+	return vc.report(vc.validateExpiration(method, key, item.Expiration))
+}
+
+func (vc *ValidatingClient) report(err *ValidationError) error {
+	if err == nil {
+		return nil
+	}
+	if vc.opts.OnViolation != nil {
+		vc.opts.OnViolation(err)
+	}
+	if vc.opts.WarnOnly {
+		return nil
+	}
+	return err
+}
+
+func validateKey(method, key string) *ValidationError {
+	if len(key) == 0 {
+		return &ValidationError{method, key, "Key", "empty"}
+	}
+	if len(key) > maxKeyLength {
+		return &ValidationError{method, key, "Key", fmt.Sprintf("length %d exceeds %d", len(key), maxKeyLength)}
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return &ValidationError{method, key, "Key", fmt.Sprintf("invalid character %q at %d", key[i], i)}
+		}
+	}
+	return nil
+}
+
+func (vc *ValidatingClient) validateExpiration(method, key string, exp int32) *ValidationError {
+	if exp < 0 {
+		return &ValidationError{method, key, "Expiration", "negative"}
+	}
+	if exp > relativeExpirationLimit && int64(exp) <= vc.now().Unix() {
+		return &ValidationError{method, key, "Expiration", "timestamp in the past"}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package memcacheex
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/golang/mock/gomock"
+)
+
+func TestValidatingClient(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+
+	for _, tt := range []struct {
+		name  string
+		call  func(c Client) error
+		field string
+	}{
+		{"LongKey", func(c Client) error { _, err := c.Get(strings.Repeat("k", 251)); return err }, "Key"},
+		{"EmptyKey", func(c Client) error { return c.Delete("") }, "Key"},
+		{"SpaceInKey", func(c Client) error { _, err := c.GetMulti([]string{"a", "b c"}); return err }, "Key"},
+		{"ControlInKey", func(c Client) error { _, err := c.Increment("a\n", 1); return err }, "Key"},
+		{"LargeValue", func(c Client) error {
+			return c.Set(&memcache.Item{Key: testKey, Value: make([]byte, 1024*1024)})
+		}, "Value"},
+		{"NegativeExpiration", func(c Client) error {
+			return c.Add(&memcache.Item{Key: testKey, Expiration: -1})
+		}, "Expiration"},
+		{"PastTimestamp", func(c Client) error {
+			return c.Touch(testKey, int32(now.Unix()-1))
+		}, "Expiration"},
+		{"CASWithoutGet", func(c Client) error {
+			return c.CompareAndSwap(&memcache.Item{Key: testKey})
+		}, "CAS"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// no expectations: the request must not be sent
+			mc := NewMockClient(gomock.NewController(t))
+			vc := NewValidatingClient(mc, ValidationOptions{})
+			vc.now = func() time.Time { return now }
+
+			var ve *ValidationError
+			if err := tt.call(vc); !errors.As(err, &ve) || ve.Field != tt.field {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		vc := NewValidatingClient(mc, ValidationOptions{})
+		vc.now = func() time.Time { return now }
+		item := &memcache.Item{Key: testKey, Value: []byte("v"), Expiration: int32(now.Unix() + 60)}
+		mc.EXPECT().Set(gomock.Eq(item)).Return(nil)
+		mc.EXPECT().Touch(gomock.Eq(testKey), gomock.Eq(int32(60))).Return(nil)
+
+		if err := vc.Set(item); err != nil {
+			t.Error(err)
+		}
+		if err := vc.Touch(testKey, 60); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("CASAfterGet", func(t *testing.T) {
+		fc := newFakeClient()
+		vc := NewValidatingClient(fc, ValidationOptions{})
+		fc.Set(&memcache.Item{Key: testKey, Value: []byte("v")})
+		item, _ := vc.Get(testKey)
+		if err := vc.CompareAndSwap(item); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("CASFieldMissing", func(t *testing.T) {
+		item := struct{ casid string }{"1"}
+		if _, ok := uintField(reflect.ValueOf(item), "casid"); ok {
+			t.Error("field of another type was read")
+		}
+		if _, ok := uintField(reflect.ValueOf(item), "missing"); ok {
+			t.Error("missing field was read")
+		}
+	})
+
+	t.Run("WarnOnly", func(t *testing.T) {
+		mc := NewMockClient(gomock.NewController(t))
+		var violations []*ValidationError
+		vc := NewValidatingClient(mc, ValidationOptions{
+			WarnOnly:    true,
+			OnViolation: func(err *ValidationError) { violations = append(violations, err) },
+		})
+		item := &memcache.Item{Key: "bad key", Expiration: -1}
+		mc.EXPECT().Set(gomock.Eq(item)).Return(testErr)
+
+		if err := vc.Set(item); err != testErr {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if len(violations) != 2 || violations[0].Field != "Key" || violations[1].Field != "Expiration" {
+			t.Errorf("unexpected violations: %v", violations)
+		}
+	})
+}
@@ -0,0 +1,268 @@
+package memcacheex
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+var _ Client = (*WriteBehind)(nil)
+
+type WriteBehindOptions struct {
+	// FlushInterval is how often pending writes are flushed.
+	// Zero defaults to 100ms.
+	FlushInterval time.Duration
+	// MaxPending flushes as soon as this many keys are pending.
+	// Zero means no limit.
+	MaxPending int
+	// OnError, if set, is called when a buffered Set fails.
+	OnError func(item *memcache.Item, err error)
+}
+
+// WriteBehind buffers Set calls in memory and writes them in the background.
+// Multiple Sets of the same key are coalesced into the last one. Get and
+// GetMulti see pending writes. Other writes to a key with a pending Set
+// flush it first. Close must be called to drain pending writes.
+type WriteBehind struct {
+	Client
+	opts WriteBehindOptions
+
+	mu       sync.Mutex
+	pending  map[string]*memcache.Item
+	flushing map[string]*memcache.Item
+	closed   bool
+
+	// flushMu serializes flushes so that writes are not reordered.
+	flushMu sync.Mutex
+	kick    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func NewWriteBehind(client Client, opts WriteBehindOptions) *WriteBehind {
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 100 * time.Millisecond
+	}
+	wb := &WriteBehind{
+		Client:  client,
+		opts:    opts,
+		pending: make(map[string]*memcache.Item),
+		kick:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go wb.loop()
+	return wb
+}
+
+func (wb *WriteBehind) loop() {
+	defer close(wb.stopped)
+	ticker := time.NewTicker(wb.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-wb.kick:
+		case <-wb.done:
+			return
+		}
+		wb.Flush()
+	}
+}
+
+// Set buffers the given item. It returns an error only after Close, when
+// items are written through.
+func (wb *WriteBehind) Set(item *memcache.Item) error {
+	wb.mu.Lock()
+	if wb.closed {
+		wb.mu.Unlock()
+		// a buffered Set that is not drained yet must not overwrite item
+		wb.flushMu.Lock()
+		defer wb.flushMu.Unlock()
+		wb.mu.Lock()
+		delete(wb.pending, item.Key)
+		wb.mu.Unlock()
+		return wb.Client.Set(item)
+	}
+	it := *item
+	it.Value = append([]byte(nil), item.Value...)
+	wb.pending[item.Key] = &it
+	full := wb.opts.MaxPending > 0 && len(wb.pending) >= wb.opts.MaxPending
+	wb.mu.Unlock()
+
+	if full {
+		select {
+		case wb.kick <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Get gets the pending item for the given key, or the item from the
+// underlying client.
+func (wb *WriteBehind) Get(key string) (*memcache.Item, error) {
+	if item, ok := wb.lookup(key); ok {
+		return item, nil
+	}
+	return wb.Client.Get(key)
+}
+
+// GetMulti is a batch version of Get.
+func (wb *WriteBehind) GetMulti(keys []string) (map[string]*memcache.Item, error) {
+	items := make(map[string]*memcache.Item, len(keys))
+	var rest []string
+	for _, key := range keys {
+		if item, ok := wb.lookup(key); ok {
+			items[key] = item
+		} else {
+			rest = append(rest, key)
+		}
+	}
+	if len(rest) == 0 {
+		return items, nil
+	}
+	fetched, err := wb.Client.GetMulti(rest)
+	if err != nil {
+		return nil, err
+	}
+	for key, item := range fetched {
+		items[key] = item
+	}
+	return items, nil
+}
+
+func (wb *WriteBehind) Touch(key string, seconds int32) error {
+	wb.flushKey(key)
+	return wb.Client.Touch(key, seconds)
+}
+
+func (wb *WriteBehind) Add(item *memcache.Item) error {
+	wb.flushKey(item.Key)
+	return wb.Client.Add(item)
+}
+
+func (wb *WriteBehind) Replace(item *memcache.Item) error {
+	wb.flushKey(item.Key)
+	return wb.Client.Replace(item)
+}
+
+func (wb *WriteBehind) CompareAndSwap(item *memcache.Item) error {
+	wb.flushKey(item.Key)
+	return wb.Client.CompareAndSwap(item)
+}
+
+func (wb *WriteBehind) Increment(key string, delta uint64) (uint64, error) {
+	wb.flushKey(key)
+	return wb.Client.Increment(key, delta)
+}
+
+func (wb *WriteBehind) Decrement(key string, delta uint64) (uint64, error) {
+	wb.flushKey(key)
+	return wb.Client.Decrement(key, delta)
+}
+
+// Delete drops the pending Set for the given key and deletes it.
+func (wb *WriteBehind) Delete(key string) error {
+	wb.flushMu.Lock()
+	defer wb.flushMu.Unlock()
+	wb.mu.Lock()
+	delete(wb.pending, key)
+	wb.mu.Unlock()
+	return wb.Client.Delete(key)
+}
+
+func (wb *WriteBehind) FlushAll() error {
+	wb.discard()
+	return wb.Client.FlushAll()
+}
+
+func (wb *WriteBehind) DeleteAll() error {
+	wb.discard()
+	return wb.Client.DeleteAll()
+}
+
+// Flush writes all pending items now.
+func (wb *WriteBehind) Flush() {
+	wb.flushMu.Lock()
+	defer wb.flushMu.Unlock()
+
+	wb.mu.Lock()
+	wb.flushing, wb.pending = wb.pending, make(map[string]*memcache.Item)
+	wb.mu.Unlock()
+
+	for _, item := range wb.flushing {
+		if err := wb.Client.Set(item); err != nil && wb.opts.OnError != nil {
+			wb.opts.OnError(item, err)
+		}
+	}
+
+	wb.mu.Lock()
+	wb.flushing = nil
+	wb.mu.Unlock()
+}
+
+// Close stops buffering and drains pending writes. It returns ctx.Err()
+// if ctx is done before all writes are drained.
+func (wb *WriteBehind) Close(ctx context.Context) error {
+	wb.mu.Lock()
+	if wb.closed {
+		wb.mu.Unlock()
+		return nil
+	}
+	wb.closed = true
+	wb.mu.Unlock()
+
+	close(wb.done)
+	drained := make(chan struct{})
+	go func() {
+		<-wb.stopped
+		wb.Flush()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (wb *WriteBehind) lookup(key string) (*memcache.Item, bool) {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	item, ok := wb.pending[key]
+	if !ok {
+		item, ok = wb.flushing[key]
+	}
+	if !ok {
+		return nil, false
+	}
+	it := *item
+	it.Value = append([]byte(nil), item.Value...)
+	return &it, true
+}
+
+func (wb *WriteBehind) flushKey(key string) {
+	wb.flushMu.Lock()
+	defer wb.flushMu.Unlock()
+	wb.mu.Lock()
+	item, ok := wb.pending[key]
+	delete(wb.pending, key)
+	wb.mu.Unlock()
+	if ok {
+		if err := wb.Client.Set(item); err != nil && wb.opts.OnError != nil {
+			wb.opts.OnError(item, err)
+		}
+	}
+}
+
+func (wb *WriteBehind) discard() {
+	wb.flushMu.Lock()
+	defer wb.flushMu.Unlock()
+	wb.mu.Lock()
+	wb.pending = make(map[string]*memcache.Item)
+	wb.mu.Unlock()
+}
@@ -0,0 +1,139 @@
+package memcacheex
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+func TestWriteBehind(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("CoalescesAndReadsOwnWrites", func(t *testing.T) {
+		fc := newFakeClient()
+		wb := NewWriteBehind(fc, WriteBehindOptions{FlushInterval: time.Hour})
+		defer wb.Close(ctx)
+
+		for _, v := range []string{"1", "2", "3"} {
+			if err := wb.Set(&memcache.Item{Key: testKey, Value: []byte(v)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if n := fc.called("Set"); n != 0 {
+			t.Errorf("Set was written through %d times", n)
+		}
+		if item, err := wb.Get(testKey); err != nil || string(item.Value) != "3" {
+			t.Errorf("unexpected result: %v, %v", item, err)
+		}
+		if items, err := wb.GetMulti([]string{testKey}); err != nil || string(items[testKey].Value) != "3" {
+			t.Errorf("unexpected result: %v, %v", items, err)
+		}
+
+		wb.Flush()
+		if n := fc.called("Set"); n != 1 {
+			t.Errorf("Set was written %d times", n)
+		}
+		if item, _ := fc.Get(testKey); string(item.Value) != "3" {
+			t.Errorf("unexpected value: %q", item.Value)
+		}
+	})
+
+	t.Run("FlushesOnMaxPending", func(t *testing.T) {
+		fc := newFakeClient()
+		wb := NewWriteBehind(fc, WriteBehindOptions{FlushInterval: time.Hour, MaxPending: 2})
+		defer wb.Close(ctx)
+
+		wb.Set(&memcache.Item{Key: "a", Value: []byte("1")})
+		wb.Set(&memcache.Item{Key: "b", Value: []byte("2")})
+		for i := 0; i < 100 && fc.called("Set") < 2; i++ {
+			time.Sleep(time.Millisecond)
+		}
+		if n := fc.called("Set"); n != 2 {
+			t.Errorf("Set was written %d times", n)
+		}
+	})
+
+	t.Run("FlushesOnInterval", func(t *testing.T) {
+		fc := newFakeClient()
+		wb := NewWriteBehind(fc, WriteBehindOptions{FlushInterval: time.Millisecond})
+		defer wb.Close(ctx)
+
+		wb.Set(&memcache.Item{Key: testKey, Value: []byte("1")})
+		for i := 0; i < 100 && fc.called("Set") < 1; i++ {
+			time.Sleep(time.Millisecond)
+		}
+		if n := fc.called("Set"); n != 1 {
+			t.Errorf("Set was written %d times", n)
+		}
+	})
+
+	t.Run("DefaultFlushInterval", func(t *testing.T) {
+		fc := newFakeClient()
+		wb := NewWriteBehind(fc, WriteBehindOptions{})
+		defer wb.Close(ctx)
+
+		wb.Set(&memcache.Item{Key: testKey, Value: []byte("1")})
+		for i := 0; i < 100 && fc.called("Set") < 1; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if n := fc.called("Set"); n != 1 {
+			t.Errorf("Set was written %d times", n)
+		}
+	})
+
+	t.Run("OtherWritesFlushKey", func(t *testing.T) {
+		fc := newFakeClient()
+		wb := NewWriteBehind(fc, WriteBehindOptions{FlushInterval: time.Hour})
+		defer wb.Close(ctx)
+
+		wb.Set(&memcache.Item{Key: testKey, Value: []byte("1")})
+		if v, err := wb.Increment(testKey, 1); err != nil || v != 2 {
+			t.Errorf("unexpected result: %d, %v", v, err)
+		}
+
+		wb.Set(&memcache.Item{Key: testKey, Value: []byte("1")})
+		wb.Delete(testKey)
+		wb.Flush()
+		if _, err := fc.Get(testKey); err != memcache.ErrCacheMiss {
+			t.Errorf("deleted key was written: %v", err)
+		}
+	})
+
+	t.Run("SetDuringClose", func(t *testing.T) {
+		fc := newFakeClient()
+		wb := NewWriteBehind(fc, WriteBehindOptions{FlushInterval: time.Hour})
+		defer close(wb.done)
+
+		wb.Set(&memcache.Item{Key: testKey, Value: []byte("old")})
+		// Close has marked wb closed but not drained it yet
+		wb.mu.Lock()
+		wb.closed = true
+		wb.mu.Unlock()
+		wb.Set(&memcache.Item{Key: testKey, Value: []byte("new")})
+		wb.Flush()
+		if item, _ := fc.Get(testKey); string(item.Value) != "new" {
+			t.Errorf("buffered value overwrote a newer one: %q", item.Value)
+		}
+	})
+
+	t.Run("CloseDrains", func(t *testing.T) {
+		fc := newFakeClient()
+		wb := NewWriteBehind(fc, WriteBehindOptions{FlushInterval: time.Hour})
+
+		wb.Set(&memcache.Item{Key: "a", Value: []byte("1")})
+		wb.Set(&memcache.Item{Key: "b", Value: []byte("2")})
+		if err := wb.Close(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if n := fc.called("Set"); n != 2 {
+			t.Errorf("Set was written %d times", n)
+		}
+
+		wb.Set(&memcache.Item{Key: "c", Value: []byte("3")})
+		if n := fc.called("Set"); n != 3 {
+			t.Error("Set after Close was not written through")
+		}
+	})
+}